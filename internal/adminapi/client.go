@@ -3,13 +3,14 @@ package adminapi
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
 	"sync"
 
 	"github.com/kong/go-kong/kong"
+
+	"kong-portal-controller/internal/certwatch"
 )
 
 var clientSetup sync.Mutex
@@ -36,11 +37,18 @@ type HTTPClientOpts struct {
 	TLSClientKey string
 }
 
+// CACertificateName and ClientCertificateName describe the TLS material of the Admin API client in metrics.
+const (
+	CACertificateName     = "kong-admin-ca"
+	ClientCertificateName = "kong-admin-client"
+)
+
 // MakeHTTPClient returns an HTTP client with the specified mTLS/headers developer.
+// The CA and client certificates provided as files are reloaded by the watcher, unless it is nil.
 // BUG: This function overwrites the default transport and client in package http!
 // This problem is being left as-is during refactoring to avoid regression of untested code.
 // https://github.com/Kong/kong-portal-controller/issues/1233
-func MakeHTTPClient(opts *HTTPClientOpts) (*http.Client, error) {
+func MakeHTTPClient(opts *HTTPClientOpts, watcher *certwatch.Watcher) (*http.Client, error) {
 	defaultTransport := http.DefaultTransport.(*http.Transport)
 
 	var tlsConfig tls.Config
@@ -58,27 +66,20 @@ func MakeHTTPClient(opts *HTTPClientOpts) (*http.Client, error) {
 			"are set; please remove one or the other")
 	}
 	if opts.CACert != "" {
-		certPool := x509.NewCertPool()
-		ok := certPool.AppendCertsFromPEM([]byte(opts.CACert))
-		if !ok {
-			// TODO give user an error to make this actionable
-			return nil, fmt.Errorf("failed to load kong-admin-ca-cert")
+		certPool, err := certwatch.ParseCertPool(CACertificateName, []byte(opts.CACert))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kong-admin-ca-cert: %w", err)
 		}
 		tlsConfig.RootCAs = certPool
 	}
+	var caPool *certwatch.CertPool
 	if opts.CACertPath != "" {
-		certPath := opts.CACertPath
-		certPool := x509.NewCertPool()
-		cert, err := os.ReadFile(certPath)
+		var err error
+		caPool, err = certwatch.NewCertPool(CACertificateName, opts.CACertPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read kong-admin-ca-cert from path '%s': %w", certPath, err)
+			return nil, fmt.Errorf("failed to load kong-admin-ca-cert from path '%s': %w", opts.CACertPath, err)
 		}
-		ok := certPool.AppendCertsFromPEM(cert)
-		if !ok {
-			// TODO give user an error to make this actionable
-			return nil, fmt.Errorf("failed to load kong-admin-ca-cert from path '%s'", certPath)
-		}
-		tlsConfig.RootCAs = certPool
+		tlsConfig.RootCAs = caPool.Pool()
 	}
 
 	// don't allow the caller to specify both the literal and path versions to supply the
@@ -92,8 +93,20 @@ func MakeHTTPClient(opts *HTTPClientOpts) (*http.Client, error) {
 			"are set; please remove one or the other")
 	}
 
+	// a certificate and a key both provided as files are reloaded when the files change
+	if opts.TLSClientCertPath != "" && opts.TLSClientKeyPath != "" {
+		keyPair, err := certwatch.NewKeyPair(ClientCertificateName, opts.TLSClientCertPath, opts.TLSClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kong-admin-tls-client-cert and kong-admin-tls-client-key certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = keyPair.GetClientCertificate
+		if watcher != nil {
+			watcher.Watch(keyPair)
+		}
+	}
+
 	// if a path to the certificate or key has been provided, retrieve the file contents
-	if opts.TLSClientCertPath != "" {
+	if opts.TLSClientCertPath != "" && opts.TLSClientKeyPath == "" {
 		tlsClientCertPath := opts.TLSClientCertPath
 		tlsClientCert, err := os.ReadFile(tlsClientCertPath)
 		if err != nil {
@@ -101,7 +114,7 @@ func MakeHTTPClient(opts *HTTPClientOpts) (*http.Client, error) {
 		}
 		opts.TLSClientCert = string(tlsClientCert)
 	}
-	if opts.TLSClientKeyPath != "" {
+	if opts.TLSClientKeyPath != "" && opts.TLSClientCertPath == "" {
 		tlsClientKeyPath := opts.TLSClientKeyPath
 		tlsClientKey, err := os.ReadFile(tlsClientKeyPath)
 		if err != nil {
@@ -121,19 +134,28 @@ func MakeHTTPClient(opts *HTTPClientOpts) (*http.Client, error) {
 
 	if opts.TLSClientCert != "" && opts.TLSClientKey != "" {
 		// Read the key pair to create certificate
-		cert, err := tls.X509KeyPair([]byte(opts.TLSClientCert), []byte(opts.TLSClientKey))
+		cert, err := certwatch.ParseKeyPair(ClientCertificateName, []byte(opts.TLSClientCert), []byte(opts.TLSClientKey))
 		if err != nil {
 			return nil, fmt.Errorf("failed to load kong-admin-tls-client-cert and kong-admin-tls-client-key certificate: %w", err)
 		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
 	}
 
 	defaultTransport.TLSClientConfig = tlsConfig.Clone()
+	var rt http.RoundTripper = defaultTransport
+	// the CA certificates of a transport cannot change, so a new transport is used for new ones
+	if caPool != nil && watcher != nil {
+		reloadingRoundTripper := &ReloadingRoundTripper{transport: defaultTransport}
+		caPool.OnReload(reloadingRoundTripper.setRootCAs)
+		watcher.Watch(caPool)
+		rt = reloadingRoundTripper
+	}
+
 	c := http.DefaultClient
 	// BUG: this overwrites the DefaultClient instance!
 	c.Transport = &HeaderRoundTripper{
 		headers: opts.Headers,
-		rt:      defaultTransport,
+		rt:      rt,
 	}
 
 	return c, nil
@@ -0,0 +1,34 @@
+package adminapi
+
+import (
+	"crypto/x509"
+	"net/http"
+	"sync"
+)
+
+// ReloadingRoundTripper sends requests via a transport trusting
+// the latest CA certificates of Kong's Admin endpoint.
+type ReloadingRoundTripper struct {
+	lock      sync.RWMutex
+	transport *http.Transport
+}
+
+// RoundTrip satisfies the RoundTripper interface.
+func (t *ReloadingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.RLock()
+	transport := t.transport
+	t.lock.RUnlock()
+	return transport.RoundTrip(req)
+}
+
+// setRootCAs swaps the transport for one trusting the CA certificates,
+// the connections of the previous one being closed once idle.
+func (t *ReloadingRoundTripper) setRootCAs(pool *x509.CertPool) {
+	t.lock.Lock()
+	previous := t.transport
+	transport := previous.Clone()
+	transport.TLSClientConfig.RootCAs = pool
+	t.transport = transport
+	t.lock.Unlock()
+	previous.CloseIdleConnections()
+}
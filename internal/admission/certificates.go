@@ -0,0 +1,519 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kong-portal-controller/internal/certwatch"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+const (
+	// CACertKey and CAKeyKey are the keys of the CA certificate and private key in the certificate Secret,
+	// next to the serving certificate and private key under the keys of a TLS Secret.
+	CACertKey = "ca.crt"
+	CAKeyKey  = "ca.key"
+
+	// PreviousCACertKey is the key of the CA certificate replaced by the last rotation in the certificate Secret,
+	// kept in the caBundle until it expires so that the certificates it signed remain trusted meanwhile.
+	PreviousCACertKey = "ca-previous.crt"
+
+	// CAValidity and CertValidity are the validity periods of the generated CA and serving certificates.
+	CAValidity   = 5 * 365 * 24 * time.Hour
+	CertValidity = 365 * 24 * time.Hour
+
+	// CertRotationThreshold is the remaining validity below which a certificate is rotated.
+	CertRotationThreshold = 30 * 24 * time.Hour
+
+	// CertCheckInterval is the interval between two checks of the certificate Secret and webhook configurations.
+	CertCheckInterval = time.Hour
+	certRetryInterval = 10 * time.Second
+)
+
+const (
+	// DefaultCertSecret and DefaultWebhookConfiguration are the default names of the certificate Secret and
+	// of the webhook configurations, the only ones granted by the RBAC manifests.
+	DefaultCertSecret           = "kong-portal-controller-admission-cert"
+	DefaultWebhookConfiguration = "kong-portal-controller"
+
+	// DefaultCertNamespace is the namespace of the certificate Secret granted by the RBAC manifests.
+	DefaultCertNamespace = "kong"
+)
+
+var (
+	// ValidationWebhookName and DeletionWebhookName are the names of the webhooks of the created
+	// ValidatingWebhookConfiguration, validating the creations and updates of KongFiles, and their deletions.
+	ValidationWebhookName = "kongfiles.validation." + developer.SchemeGroupVersion.Group
+	DeletionWebhookName   = "kongfiles.deletion." + developer.SchemeGroupVersion.Group
+)
+
+// the certificate Secret, in the namespace of the Service, and the webhook configurations are only granted under
+// their default names, creations cannot be restricted by name. Deployments changing them must grant the access,
+// which CheckPermissions verifies at startup.
+//+kubebuilder:rbac:groups="",namespace=kong,resources=secrets,verbs=create
+//+kubebuilder:rbac:groups="",namespace=kong,resources=secrets,resourceNames=kong-portal-controller-admission-cert,verbs=get;update
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=create
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,resourceNames=kong-portal-controller,verbs=get;patch
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,resourceNames=kong-portal-controller,verbs=get;patch
+
+// CertificateManager provides the admission webhook server with a self-signed serving certificate. The CA and
+// the serving certificate are stored in a Secret shared by all the controller replicas, rotated before they
+// expire, and the CA is set as the caBundle of the webhook configurations, along with the previous CA until it expires.
+type CertificateManager struct {
+	client client.Client
+	logger logr.Logger
+
+	service                  types.NamespacedName
+	secret                   types.NamespacedName
+	webhookConfigurationName string
+	deletionFailurePolicy    FailurePolicy
+
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	secretData  map[string][]byte
+}
+
+// NewCertificateManager provides a CertificateManager for the webhook server exposed by the Service,
+// storing the certificates in the named Secret of the Service namespace. The client should not be cached,
+// so that neither the Secrets nor the webhook configurations of the cluster are watched. The deletion failure
+// policy is the one of the webhook validating the deletions of KongFiles, see validatingWebhookConfiguration.
+func NewCertificateManager(
+	logger logr.Logger,
+	client client.Client,
+	service types.NamespacedName,
+	secretName string,
+	webhookConfigurationName string,
+	deletionFailurePolicy FailurePolicy,
+) *CertificateManager {
+	return &CertificateManager{
+		client:                   client,
+		logger:                   logger,
+		service:                  service,
+		secret:                   types.NamespacedName{Namespace: service.Namespace, Name: secretName},
+		webhookConfigurationName: webhookConfigurationName,
+		deletionFailurePolicy:    deletionFailurePolicy,
+	}
+}
+
+// CheckPermissions verifies that the controller is granted the access to the certificate Secret and to the webhook
+// configurations, so that RBAC manifests granting other names or another namespace than the flags are reported
+// at startup rather than by every check of the certificates.
+func (m *CertificateManager) CheckPermissions(ctx context.Context) error {
+	const admissionGroup = "admissionregistration.k8s.io"
+	for _, attributes := range []authorizationv1.ResourceAttributes{
+		{Namespace: m.secret.Namespace, Resource: "secrets", Verb: "create"},
+		{Namespace: m.secret.Namespace, Resource: "secrets", Name: m.secret.Name, Verb: "get"},
+		{Namespace: m.secret.Namespace, Resource: "secrets", Name: m.secret.Name, Verb: "update"},
+		{Group: admissionGroup, Resource: "validatingwebhookconfigurations", Verb: "create"},
+		{Group: admissionGroup, Resource: "validatingwebhookconfigurations", Name: m.webhookConfigurationName, Verb: "get"},
+		{Group: admissionGroup, Resource: "validatingwebhookconfigurations", Name: m.webhookConfigurationName, Verb: "patch"},
+		{Group: admissionGroup, Resource: "mutatingwebhookconfigurations", Name: m.webhookConfigurationName, Verb: "get"},
+		{Group: admissionGroup, Resource: "mutatingwebhookconfigurations", Name: m.webhookConfigurationName, Verb: "patch"},
+	} {
+		attributes := attributes
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		}
+		if err := m.client.Create(ctx, review); err != nil {
+			return fmt.Errorf("failed to check the access to %s: %w", attributes.Resource, err)
+		}
+		if !review.Status.Allowed {
+			resource := attributes.Resource
+			if attributes.Name != "" {
+				resource += " " + attributes.Name
+			}
+			if attributes.Namespace != "" {
+				resource += " in namespace " + attributes.Namespace
+			}
+			return fmt.Errorf("%s of %s is not allowed: the RBAC manifests only grant the Secret %s/%s and the webhook "+
+				"configurations %s, grant the ones of the --admission-webhook-service, --admission-webhook-cert-secret "+
+				"and --admission-webhook-configuration flags", attributes.Verb, resource,
+				DefaultCertNamespace, DefaultCertSecret, DefaultWebhookConfiguration)
+		}
+	}
+	return nil
+}
+
+// NeedLeaderElection implements LeaderElectionRunnable, every replica serving the admission webhook.
+func (m *CertificateManager) NeedLeaderElection() bool {
+	return false
+}
+
+// Start ensures the certificates and the webhook configurations until the context is done,
+// retrying shortly after a failure.
+func (m *CertificateManager) Start(ctx context.Context) error {
+	for {
+		interval := CertCheckInterval
+		if err := m.reconcile(ctx); err != nil {
+			m.logger.Error(err, "Failed to ensure the admission webhook certificates", "secret", m.secret)
+			interval = certRetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// GetCertificate provides the current serving certificate to the TLS handshakes.
+func (m *CertificateManager) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if m.certificate == nil {
+		return nil, errors.New("admission webhook certificate is not ready yet")
+	}
+	return m.certificate, nil
+}
+
+// reconcile creates or rotates the certificates in the Secret, sets the CAs as the caBundle of the webhook
+// configurations and loads the serving certificate. The caBundle is set first, so that a rotated serving
+// certificate is only served once its CA is trusted.
+func (m *CertificateManager) reconcile(ctx context.Context) error {
+	secret := &corev1.Secret{}
+	err := m.client.Get(ctx, m.secret, secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: m.secret.Namespace, Name: m.secret.Name},
+			Type:       corev1.SecretTypeTLS,
+		}
+		if secret.Data, err = m.generate(nil, time.Now()); err != nil {
+			return err
+		}
+		// another replica creating the Secret first is retried with its certificates
+		if err := m.client.Create(ctx, secret); err != nil {
+			return fmt.Errorf("failed to create Secret %s: %w", m.secret, err)
+		}
+		m.logger.Info("Generated the admission webhook certificates", "secret", m.secret)
+	case err != nil:
+		return fmt.Errorf("failed to get Secret %s: %w", m.secret, err)
+	default:
+		if reason := m.rotationReason(secret.Data, time.Now()); reason != "" {
+			if secret.Data, err = m.generate(secret.Data, time.Now()); err != nil {
+				return err
+			}
+			// a conflict means another replica rotated the certificates first
+			if err := m.client.Update(ctx, secret); err != nil {
+				return fmt.Errorf("failed to update Secret %s: %w", m.secret, err)
+			}
+			m.logger.Info("Rotated the admission webhook certificates", "secret", m.secret, "reason", reason)
+		}
+	}
+
+	if err := m.ensureWebhookConfigurations(ctx, caBundle(secret.Data, time.Now())); err != nil {
+		return err
+	}
+	return m.load(secret.Data)
+}
+
+// load sets the serving certificate of the Secret data as the current one.
+func (m *CertificateManager) load(data map[string][]byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.certificate != nil && bytes.Equal(m.secretData[corev1.TLSCertKey], data[corev1.TLSCertKey]) {
+		return nil
+	}
+	certificate, err := certwatch.ParseKeyPair(AdmissionCertificateName, data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate of Secret %s: %w", m.secret, err)
+	}
+	m.certificate = certificate
+	m.secretData = data
+	return nil
+}
+
+// rotationReason provides the reason why the certificates of the Secret data must be generated again,
+// or an empty string when they are valid for the Service beyond the rotation threshold.
+func (m *CertificateManager) rotationReason(data map[string][]byte, now time.Time) string {
+	ca, _, err := parseKeyPair(data[CACertKey], data[CAKeyKey])
+	if err != nil {
+		return "invalid CA: " + err.Error()
+	}
+	cert, _, err := parseKeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return "invalid certificate: " + err.Error()
+	}
+	switch {
+	case now.Add(CertRotationThreshold).After(ca.NotAfter):
+		return "CA expiring"
+	case now.Add(CertRotationThreshold).After(cert.NotAfter):
+		return "certificate expiring"
+	case cert.CheckSignatureFrom(ca) != nil:
+		return "certificate not signed by the CA"
+	case cert.VerifyHostname(m.serviceHost()) != nil:
+		return "certificate not valid for the service"
+	default:
+		return ""
+	}
+}
+
+// generate provides the Secret data holding a serving certificate for the Service. The CA of the current
+// data is kept while it is valid beyond the rotation threshold, so that the caBundle remains unchanged.
+// Otherwise, a CA replaced before it expires is kept as the previous CA, along with the new one.
+func (m *CertificateManager) generate(current map[string][]byte, now time.Time) (map[string][]byte, error) {
+	caCertPEM, caKeyPEM, previousCACertPEM := current[CACertKey], current[CAKeyKey], current[PreviousCACertKey]
+	ca, caKey, err := parseKeyPair(caCertPEM, caKeyPEM)
+	if err != nil || now.Add(CertRotationThreshold).After(ca.NotAfter) {
+		previousCACertPEM = caCertPEM
+
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "kong-portal-controller-admission-ca"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(CAValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		if caCertPEM, caKeyPEM, err = createKeyPair(template, nil, nil); err != nil {
+			return nil, fmt.Errorf("failed to generate the admission webhook CA: %w", err)
+		}
+		if ca, caKey, err = parseKeyPair(caCertPEM, caKeyPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	host := m.serviceHost()
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: host},
+		DNSNames:    []string{m.service.Name, m.service.Name + "." + m.service.Namespace, host, host + ".cluster.local"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(CertValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certPEM, keyPEM, err := createKeyPair(template, ca, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the admission webhook certificate: %w", err)
+	}
+
+	data := map[string][]byte{
+		CACertKey:               caCertPEM,
+		CAKeyKey:                caKeyPEM,
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+	}
+	if previous, err := parseCertificate(previousCACertPEM); err == nil && now.Before(previous.NotAfter) {
+		data[PreviousCACertKey] = previousCACertPEM
+	}
+	return data, nil
+}
+
+// caBundle provides the CA of the Secret data, followed by the previous CA while it has not expired.
+func caBundle(data map[string][]byte, now time.Time) []byte {
+	previous, err := parseCertificate(data[PreviousCACertKey])
+	if err != nil || !now.Before(previous.NotAfter) {
+		return data[CACertKey]
+	}
+	return append(append([]byte{}, data[CACertKey]...), data[PreviousCACertKey]...)
+}
+
+// serviceHost provides the host name of the Service the API server calls the webhook with.
+func (m *CertificateManager) serviceHost() string {
+	return m.service.Name + "." + m.service.Namespace + ".svc"
+}
+
+// ensureWebhookConfigurations creates the ValidatingWebhookConfiguration of KongFiles when it does not exist,
+// and sets the caBundle of the webhooks of the validating and mutating webhook configurations, along with the
+// failure policy of the deletion webhook of the validating one.
+func (m *CertificateManager) ensureWebhookConfigurations(ctx context.Context, caBundle []byte) error {
+	validating := &admissionregistration.ValidatingWebhookConfiguration{}
+	err := m.client.Get(ctx, client.ObjectKey{Name: m.webhookConfigurationName}, validating)
+	switch {
+	case apierrors.IsNotFound(err):
+		validating = m.validatingWebhookConfiguration(caBundle)
+		if err := m.client.Create(ctx, validating); err != nil {
+			return fmt.Errorf("failed to create ValidatingWebhookConfiguration %s: %w", m.webhookConfigurationName, err)
+		}
+		m.logger.Info("Created the ValidatingWebhookConfiguration", "name", m.webhookConfigurationName)
+	case err != nil:
+		return fmt.Errorf("failed to get ValidatingWebhookConfiguration %s: %w", m.webhookConfigurationName, err)
+	default:
+		patch := client.MergeFromWithOptions(validating.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		clientConfigs := make([]*admissionregistration.WebhookClientConfig, 0, len(validating.Webhooks))
+		for i := range validating.Webhooks {
+			clientConfigs = append(clientConfigs, &validating.Webhooks[i].ClientConfig)
+		}
+		policyChanged := m.setDeletionFailurePolicy(validating.Webhooks)
+		if setCABundle(caBundle, clientConfigs) || policyChanged {
+			if err := m.client.Patch(ctx, validating, patch); err != nil {
+				return fmt.Errorf("failed to patch ValidatingWebhookConfiguration %s: %w", m.webhookConfigurationName, err)
+			}
+		}
+	}
+
+	// the mutating webhook is optional, it is only patched when it is deployed
+	mutating := &admissionregistration.MutatingWebhookConfiguration{}
+	err = m.client.Get(ctx, client.ObjectKey{Name: m.webhookConfigurationName}, mutating)
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to get MutatingWebhookConfiguration %s: %w", m.webhookConfigurationName, err)
+	}
+	patch := client.MergeFromWithOptions(mutating.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	clientConfigs := make([]*admissionregistration.WebhookClientConfig, 0, len(mutating.Webhooks))
+	for i := range mutating.Webhooks {
+		clientConfigs = append(clientConfigs, &mutating.Webhooks[i].ClientConfig)
+	}
+	if !setCABundle(caBundle, clientConfigs) {
+		return nil
+	}
+	if err := m.client.Patch(ctx, mutating, patch); err != nil {
+		return fmt.Errorf("failed to patch MutatingWebhookConfiguration %s: %w", m.webhookConfigurationName, err)
+	}
+	return nil
+}
+
+// setCABundle sets the caBundle of the webhook client configs, indicating whether any of them changed.
+func setCABundle(caBundle []byte, clientConfigs []*admissionregistration.WebhookClientConfig) bool {
+	changed := false
+	for _, clientConfig := range clientConfigs {
+		if !bytes.Equal(clientConfig.CABundle, caBundle) {
+			clientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+	return changed
+}
+
+// setDeletionFailurePolicy sets the failure policy of the deletion webhook, indicating whether it changed.
+func (m *CertificateManager) setDeletionFailurePolicy(webhooks []admissionregistration.ValidatingWebhook) bool {
+	failurePolicy := m.deletionWebhookFailurePolicy()
+	changed := false
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if webhook.Name != DeletionWebhookName || webhook.FailurePolicy != nil && *webhook.FailurePolicy == failurePolicy {
+			continue
+		}
+		webhook.FailurePolicy = &failurePolicy
+		changed = true
+	}
+	return changed
+}
+
+// deletionWebhookFailurePolicy provides the failure policy of the deletion webhook, ignoring its failures by default.
+func (m *CertificateManager) deletionWebhookFailurePolicy() admissionregistration.FailurePolicyType {
+	if m.deletionFailurePolicy == FailurePolicyFail {
+		return admissionregistration.Fail
+	}
+	return admissionregistration.Ignore
+}
+
+// validatingWebhookConfiguration provides the ValidatingWebhookConfiguration of KongFiles served by the Service.
+// The creations and updates are rejected while the webhook is unreachable, whereas the deletions are validated
+// by a webhook of their own whose failure policy is configurable: KongFiles carry a finalizer, so a webhook
+// failing their deletions while the controller is down would also block the teardown of their namespaces.
+func (m *CertificateManager) validatingWebhookConfiguration(caBundle []byte) *admissionregistration.ValidatingWebhookConfiguration {
+	path := "/"
+	timeoutSeconds := WebhookTimeoutSeconds
+	sideEffects := admissionregistration.SideEffectClassNone
+	webhook := func(name string, failurePolicy admissionregistration.FailurePolicyType,
+		operations ...admissionregistration.OperationType) admissionregistration.ValidatingWebhook {
+		return admissionregistration.ValidatingWebhook{
+			Name: name,
+			ClientConfig: admissionregistration.WebhookClientConfig{
+				Service: &admissionregistration.ServiceReference{
+					Namespace: m.service.Namespace,
+					Name:      m.service.Name,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			Rules: []admissionregistration.RuleWithOperations{{
+				Operations: operations,
+				Rule: admissionregistration.Rule{
+					APIGroups:   []string{kongFileGVResource.Group},
+					APIVersions: []string{kongFileGVResource.Version},
+					Resources:   []string{kongFileGVResource.Resource},
+				},
+			}},
+			FailurePolicy:           &failurePolicy,
+			TimeoutSeconds:          &timeoutSeconds,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+		}
+	}
+	return &admissionregistration.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: m.webhookConfigurationName},
+		Webhooks: []admissionregistration.ValidatingWebhook{
+			webhook(ValidationWebhookName, admissionregistration.Fail, admissionregistration.Create, admissionregistration.Update),
+			webhook(DeletionWebhookName, m.deletionWebhookFailurePolicy(), admissionregistration.Delete),
+		},
+	}
+}
+
+// createKeyPair provides a new ECDSA private key and its certificate built from the template, PEM encoded.
+// The certificate is signed by the parent certificate and key, or self-signed when they are nil.
+func createKeyPair(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serialNumber
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// parseKeyPair parses a PEM encoded certificate and its ECDSA private key.
+func parseKeyPair(certPEM, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("missing PEM data")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// parseCertificate parses a PEM encoded certificate.
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, errors.New("missing PEM data")
+	}
+	return x509.ParseCertificate(certBlock.Bytes)
+}
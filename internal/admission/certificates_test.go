@@ -0,0 +1,326 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var testService = types.NamespacedName{Namespace: "kong", Name: "kong-portal-controller-admission"}
+
+// newTestCertificateManager provides a CertificateManager of the default Secret and webhook configurations,
+// managing the provided objects.
+func newTestCertificateManager(t *testing.T, objects ...client.Object) (*CertificateManager, client.Client) {
+	t.Helper()
+	testScheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := admissionregistration.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).Build()
+	return NewCertificateManager(logr.Discard(), kubeClient, testService, DefaultCertSecret, DefaultWebhookConfiguration, FailurePolicyIgnore), kubeClient
+}
+
+// testSecret provides the certificate Secret holding certificates generated at the provided time.
+func testSecret(t *testing.T, m *CertificateManager, generatedAt time.Time) *corev1.Secret {
+	t.Helper()
+	data, err := m.generate(nil, generatedAt)
+	if err != nil {
+		t.Fatalf("generate() unexpected error: %v", err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testService.Namespace, Name: DefaultCertSecret},
+		Type:       corev1.SecretTypeTLS,
+		Data:       data,
+	}
+}
+
+func testMutatingWebhookConfiguration() *admissionregistration.MutatingWebhookConfiguration {
+	return &admissionregistration.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultWebhookConfiguration},
+		Webhooks:   []admissionregistration.MutatingWebhook{{Name: "kongfiles.mutation.developer.konghq.com"}},
+	}
+}
+
+// assertCABundles checks that the caBundle of every webhook is the provided one.
+func assertCABundles(t *testing.T, kubeClient client.Client, want []byte) {
+	t.Helper()
+	validating := &admissionregistration.ValidatingWebhookConfiguration{}
+	if err := kubeClient.Get(context.Background(), client.ObjectKey{Name: DefaultWebhookConfiguration}, validating); err != nil {
+		t.Fatalf("failed to get the ValidatingWebhookConfiguration: %v", err)
+	}
+	mutating := &admissionregistration.MutatingWebhookConfiguration{}
+	if err := kubeClient.Get(context.Background(), client.ObjectKey{Name: DefaultWebhookConfiguration}, mutating); err != nil {
+		t.Fatalf("failed to get the MutatingWebhookConfiguration: %v", err)
+	}
+	for _, webhook := range validating.Webhooks {
+		if !bytes.Equal(webhook.ClientConfig.CABundle, want) {
+			t.Errorf("caBundle of the validating webhook %s is not the expected CAs", webhook.Name)
+		}
+	}
+	for _, webhook := range mutating.Webhooks {
+		if !bytes.Equal(webhook.ClientConfig.CABundle, want) {
+			t.Errorf("caBundle of the mutating webhook %s is not the expected CAs", webhook.Name)
+		}
+	}
+}
+
+// assertServedCertificate checks that the certificate served by the manager is signed by the CA of the Secret
+// and valid for the Service.
+func assertServedCertificate(t *testing.T, m *CertificateManager, secret *corev1.Secret) {
+	t.Helper()
+	certificate, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() unexpected error: %v", err)
+	}
+	served, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(secret.Data[CACertKey])
+	if _, err := served.Verify(x509.VerifyOptions{DNSName: m.serviceHost(), Roots: roots}); err != nil {
+		t.Errorf("served certificate is not valid for the Service: %v", err)
+	}
+}
+
+func TestCertificateManagerGeneratesCertificates(t *testing.T) {
+	m, kubeClient := newTestCertificateManager(t, testMutatingWebhookConfiguration())
+	if _, err := m.GetCertificate(nil); err == nil {
+		t.Errorf("GetCertificate() provided a certificate before it is generated")
+	}
+
+	if err := m.reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile() unexpected error: %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err := kubeClient.Get(context.Background(), m.secret, secret); err != nil {
+		t.Fatalf("failed to get the certificate Secret: %v", err)
+	}
+	if reason := m.rotationReason(secret.Data, time.Now()); reason != "" {
+		t.Errorf("rotationReason() = %q for the generated certificates, want none", reason)
+	}
+	if _, ok := secret.Data[PreviousCACertKey]; ok {
+		t.Errorf("generated certificates hold a previous CA")
+	}
+	assertCABundles(t, kubeClient, secret.Data[CACertKey])
+	assertServedCertificate(t, m, secret)
+
+	// certificates valid beyond the rotation threshold are kept
+	if err := m.reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile() unexpected error: %v", err)
+	}
+	unchanged := &corev1.Secret{}
+	if err := kubeClient.Get(context.Background(), m.secret, unchanged); err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.ResourceVersion != secret.ResourceVersion {
+		t.Errorf("certificate Secret updated while its certificates are valid")
+	}
+}
+
+func TestCertificateManagerRotation(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name         string
+		generatedAt  time.Time
+		service      types.NamespacedName
+		wantNewCA    bool
+		wantPrevious bool
+	}{
+		{
+			name:        "certificate expiring",
+			generatedAt: now.Add(-CertValidity + CertRotationThreshold/2),
+		},
+		{
+			name:         "CA expiring",
+			generatedAt:  now.Add(-CAValidity + CertRotationThreshold/2),
+			wantNewCA:    true,
+			wantPrevious: true,
+		},
+		{
+			name:        "CA expired",
+			generatedAt: now.Add(-CAValidity - time.Hour),
+			wantNewCA:   true,
+		},
+		{
+			name:        "other service",
+			generatedAt: now,
+			service:     types.NamespacedName{Namespace: "kong", Name: "other"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, kubeClient := newTestCertificateManager(t, testMutatingWebhookConfiguration())
+			generator := m
+			if tt.service.Name != "" {
+				generator, _ = newTestCertificateManager(t)
+				generator.service = tt.service
+			}
+			previous := testSecret(t, generator, tt.generatedAt)
+			if err := kubeClient.Create(context.Background(), previous); err != nil {
+				t.Fatal(err)
+			}
+			if reason := m.rotationReason(previous.Data, now); reason == "" {
+				t.Fatalf("rotationReason() = none, want the certificates rotated")
+			}
+
+			if err := m.reconcile(context.Background()); err != nil {
+				t.Fatalf("reconcile() unexpected error: %v", err)
+			}
+			secret := &corev1.Secret{}
+			if err := kubeClient.Get(context.Background(), m.secret, secret); err != nil {
+				t.Fatal(err)
+			}
+			if reason := m.rotationReason(secret.Data, now); reason != "" {
+				t.Errorf("rotationReason() = %q for the rotated certificates, want none", reason)
+			}
+			if bytes.Equal(secret.Data[corev1.TLSCertKey], previous.Data[corev1.TLSCertKey]) {
+				t.Errorf("serving certificate not rotated")
+			}
+			if newCA := !bytes.Equal(secret.Data[CACertKey], previous.Data[CACertKey]); newCA != tt.wantNewCA {
+				t.Errorf("CA replaced = %t, want %t", newCA, tt.wantNewCA)
+			}
+			_, hasPrevious := secret.Data[PreviousCACertKey]
+			if hasPrevious != tt.wantPrevious {
+				t.Errorf("previous CA kept = %t, want %t", hasPrevious, tt.wantPrevious)
+			}
+
+			// the previous CA is trusted until it expires
+			wantBundle := secret.Data[CACertKey]
+			if tt.wantPrevious {
+				if !bytes.Equal(secret.Data[PreviousCACertKey], previous.Data[CACertKey]) {
+					t.Errorf("previous CA is not the replaced one")
+				}
+				wantBundle = append(append([]byte{}, secret.Data[CACertKey]...), previous.Data[CACertKey]...)
+				if expired := caBundle(secret.Data, now.Add(CertRotationThreshold)); !bytes.Equal(expired, secret.Data[CACertKey]) {
+					t.Errorf("caBundle() holds the previous CA once it expired")
+				}
+			}
+			assertCABundles(t, kubeClient, wantBundle)
+			assertServedCertificate(t, m, secret)
+		})
+	}
+}
+
+func TestCertificateManagerWebhookFailurePolicies(t *testing.T) {
+	fail, ignore := admissionregistration.Fail, admissionregistration.Ignore
+	existing := &admissionregistration.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultWebhookConfiguration},
+		Webhooks: []admissionregistration.ValidatingWebhook{
+			{Name: ValidationWebhookName, FailurePolicy: &fail},
+			{Name: DeletionWebhookName, FailurePolicy: &ignore},
+		},
+	}
+
+	for _, tt := range []struct {
+		name                  string
+		existing              []client.Object
+		deletionFailurePolicy FailurePolicy
+		want                  map[string]admissionregistration.FailurePolicyType
+	}{
+		{
+			name:                  "created ignoring the failures of deletions",
+			deletionFailurePolicy: FailurePolicyIgnore,
+			want:                  map[string]admissionregistration.FailurePolicyType{ValidationWebhookName: fail, DeletionWebhookName: ignore},
+		},
+		{
+			name:                  "created failing the deletions",
+			deletionFailurePolicy: FailurePolicyFail,
+			want:                  map[string]admissionregistration.FailurePolicyType{ValidationWebhookName: fail, DeletionWebhookName: fail},
+		},
+		{
+			name:                  "existing with another deletion failure policy",
+			existing:              []client.Object{existing.DeepCopy()},
+			deletionFailurePolicy: FailurePolicyFail,
+			want:                  map[string]admissionregistration.FailurePolicyType{ValidationWebhookName: fail, DeletionWebhookName: fail},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, kubeClient := newTestCertificateManager(t, tt.existing...)
+			m.deletionFailurePolicy = tt.deletionFailurePolicy
+
+			if err := m.reconcile(context.Background()); err != nil {
+				t.Fatalf("reconcile() unexpected error: %v", err)
+			}
+			validating := &admissionregistration.ValidatingWebhookConfiguration{}
+			if err := kubeClient.Get(context.Background(), client.ObjectKey{Name: DefaultWebhookConfiguration}, validating); err != nil {
+				t.Fatalf("failed to get the ValidatingWebhookConfiguration: %v", err)
+			}
+			if len(validating.Webhooks) != len(tt.want) {
+				t.Fatalf("ValidatingWebhookConfiguration has %d webhooks, want %d", len(validating.Webhooks), len(tt.want))
+			}
+			for _, webhook := range validating.Webhooks {
+				if webhook.FailurePolicy == nil || *webhook.FailurePolicy != tt.want[webhook.Name] {
+					t.Errorf("failure policy of the webhook %s = %v, want %s", webhook.Name, webhook.FailurePolicy, tt.want[webhook.Name])
+				}
+				for _, rule := range webhook.Rules {
+					for _, operation := range rule.Operations {
+						if deletion := operation == admissionregistration.Delete; deletion != (webhook.Name == DeletionWebhookName) {
+							t.Errorf("webhook %s validates the %s operations", webhook.Name, operation)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// reviewClient answers the SelfSubjectAccessReviews, denying the access to the resources of the provided names.
+type reviewClient struct {
+	client.Client
+	denied string
+}
+
+func (c reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	attributes := review.Spec.ResourceAttributes
+	review.Status.Allowed = c.denied == "" || attributes.Name != c.denied && attributes.Namespace != c.denied
+	return nil
+}
+
+func TestCertificateManagerCheckPermissions(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		denied  string
+		wantErr string
+	}{
+		{name: "granted"},
+		{name: "secret not granted", denied: DefaultCertSecret, wantErr: "get of secrets " + DefaultCertSecret + " in namespace kong"},
+		{name: "namespace not granted", denied: "kong", wantErr: "create of secrets in namespace kong"},
+		{name: "webhook configurations not granted", denied: DefaultWebhookConfiguration, wantErr: "get of validatingwebhookconfigurations " + DefaultWebhookConfiguration},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, kubeClient := newTestCertificateManager(t)
+			m.client = reviewClient{Client: kubeClient, denied: tt.denied}
+
+			err := m.CheckPermissions(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckPermissions() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckPermissions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
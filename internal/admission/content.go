@@ -0,0 +1,242 @@
+package admission
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"kong-portal-controller/internal/dataplane/proxy"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// omittedValue stands for the contents in field errors, which are too large to be echoed back as is.
+type omittedValue int
+
+func (v omittedValue) String() string {
+	return fmt.Sprintf("<%d bytes>", int(v))
+}
+
+// validateContentSource checks that spec.contentFrom selects exactly one source of content, which
+// the controller is able to read, instead of an inline spec.content or spec.binaryContent, and that
+// spec.contentEncoding is supported.
+func validateContentSource(spec developer.KongFileSpec, contentRoot string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.ContentEncoding != "" && spec.ContentEncoding != developer.ContentEncodingGzipBase64 {
+		allErrs = append(allErrs, field.NotSupported(path.Child("contentEncoding"), spec.ContentEncoding,
+			[]string{string(developer.ContentEncodingGzipBase64)}))
+	}
+	if len(spec.BinaryContent) > 0 {
+		if spec.ContentEncoding != "" {
+			allErrs = append(allErrs, field.Forbidden(path.Child("contentEncoding"), ErrKongFileBinaryContentEncoded))
+		}
+		if spec.Kind != developer.ASSET {
+			allErrs = append(allErrs, field.Forbidden(path.Child("binaryContent"), fmt.Sprintf(ErrKongFileBinaryContentKind, developer.ASSET)))
+		}
+		if spec.Content != "" {
+			allErrs = append(allErrs, field.Forbidden(path.Child("content"), ErrKongFileBinaryContentExclusive))
+		}
+		if spec.ContentFrom != nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("contentFrom"), ErrKongFileBinaryContentExclusive))
+		}
+	}
+	source := spec.ContentFrom
+	if source == nil {
+		return allErrs
+	}
+	sourcePath := path.Child("contentFrom")
+
+	if spec.Content != "" {
+		allErrs = append(allErrs, field.Forbidden(path.Child("content"), ErrKongFileContentFromExclusive))
+	}
+	sources := 0
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		sources++
+		allErrs = append(allErrs, validateKeyRef(ref.Name, ref.Key, sourcePath.Child("configMapKeyRef"))...)
+	}
+	if ref := source.SecretKeyRef; ref != nil {
+		sources++
+		allErrs = append(allErrs, validateKeyRef(ref.Name, ref.Key, sourcePath.Child("secretKeyRef"))...)
+	}
+	if source.File != "" {
+		sources++
+		if err := proxy.ValidateContentFile(source.File); err != nil {
+			allErrs = append(allErrs, field.Invalid(sourcePath.Child("file"), source.File, err.Error()))
+		} else if contentRoot == "" {
+			allErrs = append(allErrs, field.Forbidden(sourcePath.Child("file"), ErrKongFileContentFromNoRoot))
+		}
+	}
+	switch {
+	case sources == 0:
+		allErrs = append(allErrs, field.Required(sourcePath, ErrKongFileContentFromNone))
+	case sources > 1:
+		allErrs = append(allErrs, field.Forbidden(sourcePath, ErrKongFileContentFromSeveral))
+	}
+	return allErrs
+}
+
+// validateKeyRef checks that a reference to the key of a ConfigMap or a Secret is complete.
+func validateKeyRef(name, key string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if name == "" {
+		allErrs = append(allErrs, field.Required(path.Child("name"), ErrKongFileContentFromEmpty))
+	}
+	if key == "" {
+		allErrs = append(allErrs, field.Required(path.Child("key"), ErrKongFileContentFromEmpty))
+	}
+	return allErrs
+}
+
+// validateContentType checks that the extension of the name of a binary file matches the type of its contents,
+// when both are known.
+func validateContentType(spec developer.KongFileSpec, path *field.Path) *field.Error {
+	expected := proxy.ExtensionContentTypes(spec.Name)
+	detected := proxy.SniffContentType(spec.BinaryContent)
+	if len(expected) == 0 || detected == proxy.DefaultContentType {
+		return nil
+	}
+	for _, contentType := range expected {
+		if contentType == detected {
+			return nil
+		}
+	}
+	return field.Invalid(path, spec.Name, fmt.Sprintf(ErrKongFileContentTypeMismatch, detected, strings.Join(expected, ", ")))
+}
+
+// validateSpecification checks that the content is an OpenAPI 2, OpenAPI 3 or AsyncAPI 2 document
+// with the fields required by its specification, written in YAML or JSON.
+func validateSpecification(content string, path *field.Path) field.ErrorList {
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return field.ErrorList{field.Invalid(path, omittedValue(len(content)), fmt.Sprintf(ErrKongFileSpecificationMalformed, err))}
+	}
+
+	var required []string
+	switch {
+	case document["swagger"] != nil:
+		if version := versionOf(document["swagger"]); version != "2.0" {
+			return field.ErrorList{field.Invalid(path.Child("swagger"), version, fmt.Sprintf(ErrKongFileSpecificationVersion, "2.0"))}
+		}
+		required = []string{"info.title", "info.version", "paths"}
+	case document["openapi"] != nil:
+		version := versionOf(document["openapi"])
+		if !strings.HasPrefix(version, "3.") {
+			return field.ErrorList{field.Invalid(path.Child("openapi"), version, fmt.Sprintf(ErrKongFileSpecificationVersion, "3.x.y"))}
+		}
+		required = []string{"info.title", "info.version"}
+		// OpenAPI 3.1 documents may only describe components or webhooks
+		if strings.HasPrefix(version, "3.0") || (document["components"] == nil && document["webhooks"] == nil) {
+			required = append(required, "paths")
+		}
+	case document["asyncapi"] != nil:
+		if version := versionOf(document["asyncapi"]); !strings.HasPrefix(version, "2.") {
+			return field.ErrorList{field.Invalid(path.Child("asyncapi"), version, fmt.Sprintf(ErrKongFileSpecificationVersion, "2.x.y"))}
+		}
+		required = []string{"info.title", "info.version", "channels"}
+	default:
+		return field.ErrorList{field.Invalid(path, omittedValue(len(content)), ErrKongFileSpecificationUnknown)}
+	}
+
+	var allErrs field.ErrorList
+	for _, name := range required {
+		if !hasField(document, name) {
+			allErrs = append(allErrs, field.Required(path.Child(name), ErrKongFileSpecificationFieldMissing))
+		}
+	}
+	return allErrs
+}
+
+// validateFrontMatter checks that the front matter rendered in the contents of a CONTENT file holds
+// the title and the layout of the KongFile as they are, each on its own line, and that the content
+// does not start with a front matter of its own.
+func validateFrontMatter(kongFile developer.KongFile, contents string, path *field.Path) field.ErrorList {
+	entries := []struct{ key, value string }{
+		{"title", kongFile.Spec.Title},
+		{"layout", kongFile.Spec.Layout},
+	}
+
+	var allErrs field.ErrorList
+	if fieldErr := validateContentFrontMatter(kongFile.Spec.Content, path.Child("content")); fieldErr != nil {
+		allErrs = append(allErrs, fieldErr)
+	}
+	for _, entry := range entries {
+		if strings.ContainsAny(entry.value, "\r\n") {
+			allErrs = append(allErrs, field.Invalid(path.Child(entry.key), entry.value, ErrKongFileFrontMatterLines))
+		}
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	// the title and the layout are rendered on the lines following the front matter opening
+	lines := strings.SplitN(contents, "\n", len(entries)+2)
+	for i, entry := range entries {
+		frontMatter := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(lines[i+1]), &frontMatter); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child(entry.key), entry.value,
+				fmt.Sprintf(ErrKongFileFrontMatterMalformed, err)))
+		} else if value, ok := frontMatter[entry.key].(string); !ok || value != entry.value {
+			allErrs = append(allErrs, field.Invalid(path.Child(entry.key), entry.value, ErrKongFileFrontMatterValue))
+		}
+	}
+	return allErrs
+}
+
+// validateContentFrontMatter checks that the content does not start with a front matter block, which
+// would follow the one rendered from the title and the layout and be published as is.
+func validateContentFrontMatter(content string, path *field.Path) *field.Error {
+	lines := strings.Split(content, "\n")
+	if strings.TrimRight(lines[0], " \t\r") != "---" {
+		return nil
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " \t\r") != "---" {
+			continue
+		}
+		frontMatter := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:i], "\n")), &frontMatter); err != nil {
+			return field.Invalid(path, omittedValue(len(content)), fmt.Sprintf(ErrKongFileContentFrontMatterMalformed, err))
+		}
+		return field.Invalid(path, omittedValue(len(content)), ErrKongFileContentFrontMatter)
+	}
+	return field.Invalid(path, omittedValue(len(content)), fmt.Sprintf(ErrKongFileContentFrontMatterMalformed, "the block is not closed"))
+}
+
+// versionOf provides the version held by a document field, YAML parsing unquoted versions as numbers:
+// whole numbers such as 3.0 are provided with their minor version, as in "3.0".
+func versionOf(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		if value == math.Trunc(value) {
+			return strconv.FormatFloat(value, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// hasField indicates whether the document holds a non empty value at the dot separated path.
+func hasField(document map[string]interface{}, path string) bool {
+	var value interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		value = object[key]
+	}
+	switch value := value.(type) {
+	case nil:
+		return false
+	case string:
+		return value != ""
+	default:
+		return true
+	}
+}
@@ -0,0 +1,40 @@
+package admission
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// pngHeader starts the contents of PNG images.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestValidateContentType(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		fileName string
+		data     []byte
+		wantErr  bool
+	}{
+		{name: "matching extension", fileName: "logo.png", data: pngHeader},
+		{name: "matching uppercase extension", fileName: "LOGO.PNG", data: pngHeader},
+		{name: "mismatching extension", fileName: "logo.jpg", data: pngHeader, wantErr: true},
+		{name: "mismatching font extension", fileName: "font.woff2", data: pngHeader, wantErr: true},
+		{name: "unknown extension", fileName: "logo.xyz", data: pngHeader},
+		{name: "no extension", fileName: "logo", data: pngHeader},
+		{name: "contents not sniffed", fileName: "font.woff2", data: []byte{0x00, 0x01, 0x02}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := developer.KongFileSpec{Kind: developer.ASSET, Name: tt.fileName, BinaryContent: tt.data}
+			fieldErr := validateContentType(spec, field.NewPath("spec", "name"))
+			if (fieldErr != nil) != tt.wantErr {
+				t.Fatalf("validateContentType() = %v, want an error %t", fieldErr, tt.wantErr)
+			}
+			if fieldErr != nil && (fieldErr.Type != field.ErrorTypeInvalid || fieldErr.Field != "spec.name") {
+				t.Errorf("validateContentType() = %v, want an invalid spec.name", fieldErr)
+			}
+		})
+	}
+}
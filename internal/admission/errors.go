@@ -6,4 +6,44 @@ const (
 	ErrKongFileSpecPathEmpty   = "file path cannot be empty"
 	ErrKongFileSpecTitleEmpty  = "file title cannot be empty"
 	ErrKongFileSpecLayoutEmpty = "file layout cannot be empty"
+
+	ErrKongFileSpecificationMalformed    = "specification is not a valid YAML or JSON document: %v"
+	ErrKongFileSpecificationUnknown      = "specification must be an OpenAPI 2, OpenAPI 3 or AsyncAPI 2 document"
+	ErrKongFileSpecificationVersion      = "specification version is not supported, expected %s"
+	ErrKongFileSpecificationFieldMissing = "specification field is required"
+
+	ErrKongFileFrontMatterLines     = "cannot span several lines in the front matter"
+	ErrKongFileFrontMatterMalformed = "does not render a valid front matter: %v"
+	ErrKongFileFrontMatterValue     = "cannot be written as is in the front matter"
+
+	ErrKongFileContentFrontMatter          = "content cannot start with a front matter, it is rendered from the title and the layout"
+	ErrKongFileContentFrontMatterMalformed = "content starts with a malformed front matter: %v"
+
+	ErrKongFilePathConflict = "file path %q is already published by KongFile %s/%s"
+
+	ErrKongFileContentFromExclusive = "content and contentFrom are mutually exclusive"
+	ErrKongFileContentFromNone      = "one of configMapKeyRef, secretKeyRef or file is required"
+	ErrKongFileContentFromSeveral   = "only one of configMapKeyRef, secretKeyRef or file may be set"
+	ErrKongFileContentFromEmpty     = "content reference field cannot be empty"
+	ErrKongFileContentFromNoRoot    = "content files are disabled, the controller has no content root"
+
+	ErrKongFileBinaryContentKind      = "binary content is only supported by %s files"
+	ErrKongFileBinaryContentExclusive = "binaryContent is mutually exclusive with content and contentFrom"
+	ErrKongFileBinaryContentEncoded   = "binaryContent cannot be encoded"
+	ErrKongFileContentTypeMismatch    = "extension does not match the detected content type %s, expected %s"
+
+	ErrKongFileLayoutNotFound     = "layout does not exist in the portal theme %q"
+	ErrKongFileLayoutUnverifiable = "layout could not be checked: %v"
+
+	ErrKongFileLocked                 = "KongFile is locked by the %s annotation"
+	ErrKongFileMoveForbidden          = "moving the file from %q to %q requires the %s annotation"
+	ErrKongFileReferenced             = "file %q is referenced by %s"
+	ErrKongFileReferencesUnverifiable = "references to the file from the portal theme layouts could not be checked: %v"
+	ErrKongFileReferencesUnchecked    = "references to the file from KongFiles could not be checked: %v"
+)
+
+const (
+	WarnKongFileLargeAsset   = "%s: asset of %d bytes is unusually large, consider serving it from a CDN"
+	WarnKongFileFieldIgnored = "%s: field is ignored by %s files"
+	WarnKongFileContentFrom  = "%s: %v, the content will be published once it resolves and was not checked"
 )
@@ -0,0 +1,106 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	services "kong-portal-controller/internal/kong"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// LayoutPolicy defines how the validator handles a CONTENT KongFile whose layout is missing from the portal theme.
+type LayoutPolicy string
+
+const (
+	// LayoutPolicyDeny rejects the KongFile.
+	LayoutPolicyDeny LayoutPolicy = "deny"
+
+	// LayoutPolicyWarn accepts the KongFile with a warning.
+	LayoutPolicyWarn LayoutPolicy = "warn"
+
+	// LayoutPolicyIgnore skips the layout check.
+	LayoutPolicyIgnore LayoutPolicy = "ignore"
+)
+
+// ParseLayoutPolicy validates the provided layout policy.
+func ParseLayoutPolicy(policy string) (LayoutPolicy, error) {
+	switch LayoutPolicy(policy) {
+	case LayoutPolicyDeny, LayoutPolicyWarn, LayoutPolicyIgnore:
+		return LayoutPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("%q is not a valid layout policy, expected one of %s, %s or %s",
+			policy, LayoutPolicyDeny, LayoutPolicyWarn, LayoutPolicyIgnore)
+	}
+}
+
+// FailurePolicy defines how the validator handles checks which cannot be completed because Kong is unreachable.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail rejects the KongFile.
+	FailurePolicyFail FailurePolicy = "fail"
+
+	// FailurePolicyIgnore accepts the KongFile with a warning.
+	FailurePolicyIgnore FailurePolicy = "ignore"
+)
+
+// ParseFailurePolicy validates the provided failure policy.
+func ParseFailurePolicy(policy string) (FailurePolicy, error) {
+	switch FailurePolicy(policy) {
+	case FailurePolicyFail, FailurePolicyIgnore:
+		return FailurePolicy(policy), nil
+	default:
+		return "", fmt.Errorf("%q is not a valid failure policy, expected one of %s or %s",
+			policy, FailurePolicyFail, FailurePolicyIgnore)
+	}
+}
+
+const (
+	// WebhookTimeoutSeconds is how long the API server waits for the generated validating webhook.
+	WebhookTimeoutSeconds int32 = 10
+
+	// MaxKongTimeout caps the deadline of the calls made to Kong while validating a request, clearly below
+	// WebhookTimeoutSeconds, so that the failure policy applies before the API server gives up on the webhook.
+	MaxKongTimeout = 3 * time.Second
+)
+
+// LayoutPath provides the path of a layout of the theme in Kong.
+func LayoutPath(theme, layout string) string {
+	return "themes/" + theme + "/layouts/" + layout
+}
+
+// validateLayout checks that the layout of a CONTENT KongFile exists in the portal theme. Theme layouts
+// cannot be published through KongFiles, so the layout is resolved against the files in Kong. Depending
+// on the policies, a failed check is either an error or a warning.
+func (validator KongHTTPValidator) validateLayout(
+	ctx context.Context,
+	kongFile developer.KongFile,
+	fieldPath *field.Path,
+) (*field.Error, []string) {
+	if validator.LayoutPolicy == LayoutPolicyIgnore || validator.FileService == nil {
+		return nil, nil
+	}
+
+	path := LayoutPath(validator.Theme, kongFile.Spec.Layout)
+	_, err := validator.FileService.Get(ctx, &services.File{Path: &path})
+	switch {
+	case err == nil:
+		return nil, nil
+	case services.IsNotFound(err):
+		fieldErr := field.Invalid(fieldPath, kongFile.Spec.Layout, fmt.Sprintf(ErrKongFileLayoutNotFound, validator.Theme))
+		if validator.LayoutPolicy == LayoutPolicyWarn {
+			return nil, []string{fieldErr.Error()}
+		}
+		return fieldErr, nil
+	default:
+		validator.Logger.Error(err, "Failed to fetch layout from Kong", "path", path)
+		fieldErr := field.Invalid(fieldPath, kongFile.Spec.Layout, fmt.Sprintf(ErrKongFileLayoutUnverifiable, err))
+		if validator.FailurePolicy == FailurePolicyIgnore {
+			return nil, []string{fieldErr.Error()}
+		}
+		return fieldErr, nil
+	}
+}
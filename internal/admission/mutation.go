@@ -0,0 +1,121 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	admission "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"kong-portal-controller/internal/annotations"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// jsonPatchOperation is an operation of a JSONPatch (RFC 6902).
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// handleMutation answers an AdmissionRequest with the JSONPatch setting the defaults of the object.
+func (a RequestHandler) handleMutation(request admission.AdmissionRequest) (*admission.AdmissionResponse, error) {
+	var patch []jsonPatchOperation
+
+	// objects being deleted have no defaults to set
+	if request.Operation == admission.Delete {
+		return &admission.AdmissionResponse{UID: request.UID, Allowed: true}, nil
+	}
+
+	switch request.Resource {
+	case kongFileGVResource:
+		var err error
+		var oldRaw []byte
+		if request.Operation == admission.Update {
+			oldRaw = request.OldObject.Raw
+		}
+		patch, err = a.defaultKongFile(request.Object.Raw, oldRaw)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown resource type to mutate: %s/%s %s",
+			request.Resource.Group, request.Resource.Version,
+			request.Resource.Resource)
+	}
+
+	response := &admission.AdmissionResponse{
+		UID:     request.UID,
+		Allowed: true,
+	}
+	if len(patch) > 0 {
+		body, err := json.Marshal(patch)
+		if err != nil {
+			return nil, err
+		}
+		patchType := admission.PatchTypeJSONPatch
+		response.Patch = body
+		response.PatchType = &patchType
+	}
+	return response, nil
+}
+
+// defaultKongFile provides the JSONPatch setting the defaults of a KongFile: its file name and its kind,
+// its controller class annotation, and a path without leading or trailing slashes. The spec defaults are
+// left out of the updates which keep the spec of the old KongFile, if any, as is: they would be refused
+// as spec changes of locked KongFiles, and would block the updates of their metadata.
+func (a RequestHandler) defaultKongFile(raw, oldRaw []byte) ([]jsonPatchOperation, error) {
+	kongFile := developer.KongFile{}
+	if _, _, err := codecs.UniversalDeserializer().Decode(raw, nil, &kongFile); err != nil {
+		return nil, err
+	}
+	// the patch applies to the object as sent, which may have no spec at all
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+
+	var patch []jsonPatchOperation
+	if len(oldRaw) > 0 {
+		oldKongFile := developer.KongFile{}
+		if _, _, err := codecs.UniversalDeserializer().Decode(oldRaw, nil, &oldKongFile); err != nil {
+			return nil, err
+		}
+		if equality.Semantic.DeepEqual(oldKongFile.Spec, kongFile.Spec) {
+			return a.defaultControllerClass(kongFile), nil
+		}
+	}
+
+	if _, ok := object["spec"].(map[string]interface{}); !ok {
+		patch = append(patch, jsonPatchOperation{Op: "add", Path: "/spec", Value: map[string]interface{}{}})
+	}
+	if kongFile.Spec.Name == "" && kongFile.Name != "" {
+		patch = append(patch, jsonPatchOperation{Op: "add", Path: "/spec/name", Value: kongFile.Name})
+	}
+	if kongFile.Spec.Kind == "" {
+		patch = append(patch, jsonPatchOperation{Op: "add", Path: "/spec/kind", Value: developer.CONTENT})
+	}
+	if path := strings.Trim(kongFile.Spec.Path, "/"); path != kongFile.Spec.Path {
+		patch = append(patch, jsonPatchOperation{Op: "replace", Path: "/spec/path", Value: path})
+	}
+	return append(patch, a.defaultControllerClass(kongFile)...), nil
+}
+
+// defaultControllerClass provides the JSONPatch setting the controller class annotation of a KongFile missing one.
+func (a RequestHandler) defaultControllerClass(kongFile developer.KongFile) []jsonPatchOperation {
+	if _, ok := kongFile.Annotations[annotations.ControllerClassKey]; ok || a.ControllerClassName == "" {
+		return nil
+	}
+	if kongFile.Annotations == nil {
+		return []jsonPatchOperation{{Op: "add", Path: "/metadata/annotations", Value: map[string]string{
+			annotations.ControllerClassKey: a.ControllerClassName,
+		}}}
+	}
+	return []jsonPatchOperation{{Op: "add", Path: "/metadata/annotations/" + escapeJSONPointer(annotations.ControllerClassKey), Value: a.ControllerClassName}}
+}
+
+// escapeJSONPointer escapes a key to be used as a JSON pointer (RFC 6901) token.
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,152 @@
+package admission
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	admission "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kong-portal-controller/internal/annotations"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// patchOf provides the operations of the JSONPatch of the response, as JSON.
+func patchOf(t *testing.T, response *admission.AdmissionResponse) []string {
+	t.Helper()
+	if len(response.Patch) == 0 {
+		if response.PatchType != nil {
+			t.Errorf("handleMutation() patch type = %s without a patch", *response.PatchType)
+		}
+		return nil
+	}
+	if response.PatchType == nil || *response.PatchType != admission.PatchTypeJSONPatch {
+		t.Errorf("handleMutation() patch type = %v, want %s", response.PatchType, admission.PatchTypeJSONPatch)
+	}
+	var patch []json.RawMessage
+	if err := json.Unmarshal(response.Patch, &patch); err != nil {
+		t.Fatalf("handleMutation() patch is not a JSONPatch: %v", err)
+	}
+	operations := make([]string, 0, len(patch))
+	for _, operation := range patch {
+		operations = append(operations, string(operation))
+	}
+	return operations
+}
+
+func TestHandleMutation(t *testing.T) {
+	classAnnotation := `{"op":"add","path":"/metadata/annotations","value":{"` + annotations.ControllerClassKey + `":"kong"}}`
+	withClass := func(kongFile *developer.KongFile) *developer.KongFile {
+		kongFile.Annotations = map[string]string{annotations.ControllerClassKey: "other"}
+		return kongFile
+	}
+	minimal := func() *developer.KongFile {
+		obj := &developer.KongFile{}
+		obj.Namespace = "default"
+		obj.Name = "guide.md"
+		return obj
+	}
+	slashedPath := func() *developer.KongFile {
+		obj := withClass(testContentFile("guide", "# Guide"))
+		obj.Spec.Path = "/guides/"
+		return obj
+	}
+
+	for _, tt := range []struct {
+		name        string
+		operation   admission.Operation
+		kongFile    *developer.KongFile
+		oldKongFile *developer.KongFile
+		raw         string
+		want        []string
+	}{
+		{
+			name:      "create without spec",
+			operation: admission.Create,
+			raw:       `{"apiVersion":"developer.konghq.com/v1","kind":"KongFile","metadata":{"name":"guide.md"}}`,
+			want: []string{
+				`{"op":"add","path":"/spec","value":{}}`,
+				`{"op":"add","path":"/spec/name","value":"guide.md"}`,
+				`{"op":"add","path":"/spec/kind","value":"CONTENT"}`,
+				classAnnotation,
+			},
+		},
+		{
+			name:      "create with empty fields",
+			operation: admission.Create,
+			kongFile:  minimal(),
+			want: []string{
+				`{"op":"add","path":"/spec/name","value":"guide.md"}`,
+				`{"op":"add","path":"/spec/kind","value":"CONTENT"}`,
+				classAnnotation,
+			},
+		},
+		{
+			name:      "create with other annotations",
+			operation: admission.Create,
+			kongFile: func() *developer.KongFile {
+				obj := testContentFile("guide", "# Guide")
+				obj.Annotations = map[string]string{annotations.LockedKey: "true"}
+				return obj
+			}(),
+			want: []string{`{"op":"add","path":"/metadata/annotations/developer.konghq.com~1controller.class","value":"kong"}`},
+		},
+		{
+			name:      "create with slashed path",
+			operation: admission.Create,
+			kongFile:  slashedPath(),
+			want:      []string{`{"op":"replace","path":"/spec/path","value":"guides"}`},
+		},
+		{
+			name:      "create with defaults",
+			operation: admission.Create,
+			kongFile:  withClass(testContentFile("guide", "# Guide")),
+		},
+		{
+			name:        "update changing the spec",
+			operation:   admission.Update,
+			kongFile:    slashedPath(),
+			oldKongFile: withClass(testContentFile("guide", "# Previous")),
+			want:        []string{`{"op":"replace","path":"/spec/path","value":"guides"}`},
+		},
+		{
+			// the spec defaults of a KongFile created before the webhook would be refused once it is locked
+			name:        "update keeping the spec",
+			operation:   admission.Update,
+			kongFile:    minimal(),
+			oldKongFile: withClass(minimal()),
+			want:        []string{classAnnotation},
+		},
+		{
+			name:        "update keeping the spec and the class",
+			operation:   admission.Update,
+			kongFile:    slashedPath(),
+			oldKongFile: slashedPath(),
+		},
+		{
+			name:        "delete",
+			operation:   admission.Delete,
+			oldKongFile: minimal(),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequestHandler{ControllerClassName: "kong", Logger: logr.Discard()}
+			request := admissionRequest(t, tt.operation, tt.kongFile, tt.oldKongFile)
+			if tt.raw != "" {
+				request.Object = runtime.RawExtension{Raw: []byte(tt.raw)}
+			}
+
+			response, err := handler.handleMutation(request)
+			if err != nil {
+				t.Fatalf("handleMutation() unexpected error: %v", err)
+			}
+			if !response.Allowed || response.UID != request.UID {
+				t.Errorf("handleMutation() = %+v, want request %q allowed", response, request.UID)
+			}
+			if patch := patchOf(t, response); !equalStrings(patch, tt.want) {
+				t.Errorf("handleMutation() patch = %v, want %v", patch, tt.want)
+			}
+		})
+	}
+}
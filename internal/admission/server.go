@@ -4,16 +4,23 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-logr/logr"
 	"io"
 	"net/http"
 	"os"
+	"time"
 
 	admission "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"kong-portal-controller/internal/certwatch"
 	developer "kong-portal-controller/pkg/apis/v1"
 )
 
@@ -27,6 +34,12 @@ const (
 	DefaultAdmissionWebhookKeyPath  = "/admission-webhook/tls.key"
 )
 
+// ListenOff is the listen address disabling the admission webhook server.
+const ListenOff = "off"
+
+// ShutdownTimeout is the time given to the in-flight admission requests to complete on shutdown.
+const ShutdownTimeout = 10 * time.Second
+
 type ServerConfig struct {
 	ListenAddr string
 
@@ -35,67 +48,129 @@ type ServerConfig struct {
 
 	KeyPath string
 	Key     string
+
+	// Service is the "namespace/name" of the Service exposing the server, which the self-managed
+	// certificates are generated for.
+	Service string
+	// CertSecret is the name of the Secret of the Service namespace storing the self-managed certificates.
+	CertSecret string
+	// WebhookConfiguration is the name of the webhook configurations whose caBundle is set to the self-managed CA.
+	WebhookConfiguration string
 }
 
-func readKeyPairFiles(certPath, keyPath string) ([]byte, []byte, error) {
-	cert, err := os.ReadFile(certPath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("read cert from file %q: %w", certPath, err)
-	}
-	key, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("read key from file %q: %w", keyPath, err)
+// UsesSelfManagedCertificates indicates whether the server generates its own certificates,
+// which is the case when no certificate is supplied, neither as flags nor at the default paths.
+func (sc *ServerConfig) UsesSelfManagedCertificates() bool {
+	if sc.CertPath != "" || sc.KeyPath != "" || sc.Cert != "" || sc.Key != "" {
+		return false
 	}
-
-	return cert, key, nil
+	_, certErr := os.Stat(DefaultAdmissionWebhookCertPath)
+	_, keyErr := os.Stat(DefaultAdmissionWebhookKeyPath)
+	return errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist)
 }
 
-func (sc *ServerConfig) toTLSConfig() (*tls.Config, error) {
-	var cert, key []byte
+// AdmissionCertificateName describes the certificate of the admission webhook server in metrics.
+const AdmissionCertificateName = "admission-webhook"
+
+// toTLSConfig provides the TLS config serving the certificate of the config. The certificate files are
+// reloaded by the watcher when they change, unless it is nil.
+func (sc *ServerConfig) toTLSConfig(watcher *certwatch.Watcher) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	certPath, keyPath := sc.CertPath, sc.KeyPath
 	switch {
 	case sc.CertPath == "" && sc.KeyPath == "" && sc.Cert != "" && sc.Key != "":
-		cert, key = []byte(sc.Cert), []byte(sc.Key)
-
-	case sc.CertPath != "" && sc.KeyPath != "" && sc.Cert == "" && sc.Key == "":
-		var err error
-		cert, key, err = readKeyPairFiles(sc.CertPath, sc.KeyPath)
+		cert, err := certwatch.ParseKeyPair(AdmissionCertificateName, []byte(sc.Cert), []byte(sc.Key))
 		if err != nil {
 			return nil, err
 		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+		return tlsConfig, nil
+
+	case sc.CertPath != "" && sc.KeyPath != "" && sc.Cert == "" && sc.Key == "":
 
 	case sc.CertPath == "" && sc.KeyPath == "" && sc.Cert == "" && sc.Key == "":
-		var err error
-		cert, key, err = readKeyPairFiles(DefaultAdmissionWebhookCertPath, DefaultAdmissionWebhookKeyPath)
-		if err != nil {
-			return nil, err
-		}
+		certPath, keyPath = DefaultAdmissionWebhookCertPath, DefaultAdmissionWebhookKeyPath
 
 	default:
 		return nil, fmt.Errorf("either cert/key files OR cert/key values must be provided, or none")
 	}
 
-	keyPair, err := tls.X509KeyPair(cert, key)
+	keyPair, err := certwatch.NewKeyPair(AdmissionCertificateName, certPath, keyPath)
 	if err != nil {
-		return nil, fmt.Errorf("X509KeyPair error: %w", err)
+		return nil, err
 	}
-	return &tls.Config{
-		MinVersion:   tls.VersionTLS12,
-		Certificates: []tls.Certificate{keyPair},
-	}, nil
+	tlsConfig.GetCertificate = keyPair.GetCertificate
+	if watcher != nil {
+		watcher.Watch(keyPair)
+	}
+	return tlsConfig, nil
 }
 
-func MakeTLSServer(config *ServerConfig, handler http.Handler) (*http.Server, error) {
-	tlsConfig, err := config.toTLSConfig()
-	if err != nil {
-		return nil, err
+// MakeTLSServer provides the admission webhook server. The serving certificate is provided by the
+// certificate manager when the certificates are self-managed, and by the config otherwise, its files
+// being reloaded by the watcher.
+func MakeTLSServer(
+	logger logr.Logger,
+	config *ServerConfig,
+	handler http.Handler,
+	certificates *CertificateManager,
+	watcher *certwatch.Watcher,
+) (*Server, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certificates != nil {
+		tlsConfig.GetCertificate = certificates.GetCertificate
+	} else {
+		var err error
+		if tlsConfig, err = config.toTLSConfig(watcher); err != nil {
+			return nil, err
+		}
 	}
-	return &http.Server{
-		Addr:      config.ListenAddr,
-		TLSConfig: tlsConfig,
-		Handler:   handler,
+	return &Server{
+		logger: logger,
+		server: &http.Server{
+			Addr:      config.ListenAddr,
+			TLSConfig: tlsConfig,
+			Handler:   handler,
+		},
 	}, nil
 }
 
+// Server serves the admission webhook on every replica until the manager context is done.
+type Server struct {
+	logger logr.Logger
+	server *http.Server
+}
+
+// NeedLeaderElection implements LeaderElectionRunnable, every replica serving the admission webhook.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the admission webhook until the context is done, then shuts the server down gracefully.
+func (s *Server) Start(ctx context.Context) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("admission webhook server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("Shutting down the admission webhook server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("admission webhook server shutdown: %w", err)
+	}
+	return nil
+}
+
+// MutatePath is the path of the mutating webhook, every other path serves the validating webhook.
+const MutatePath = "/mutate"
+
 // RequestHandler is an HTTP server that can validate Kong Ingress Controllers'
 // Custom Resources using Kubernetes Admission Webhooks.
 type RequestHandler struct {
@@ -103,11 +178,14 @@ type RequestHandler struct {
 	// it the server to validate.
 	Validator KongValidator
 
+	// ControllerClassName is the controller class set on the objects missing one by the mutating webhook.
+	ControllerClassName string
+
 	Logger logr.Logger
 }
 
 // ServeHTTP parses AdmissionReview requests and responds back
-// with the validation result of the entity.
+// with the validation result of the entity, or with its defaults on MutatePath.
 func (a RequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
 		a.Logger.Info("received request with empty body")
@@ -127,7 +205,12 @@ func (a RequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	response, err := a.handleValidation(r.Context(), *review.Request)
+	var response *admission.AdmissionResponse
+	if r.URL.Path == MutatePath {
+		response, err = a.handleMutation(*review.Request)
+	} else {
+		response, err = a.handleValidation(r.Context(), *review.Request)
+	}
 	if err != nil {
 		a.Logger.Error(err, "failed to run validation: %v", err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -160,21 +243,41 @@ func (a RequestHandler) handleValidation(ctx context.Context, request admission.
 	*admission.AdmissionResponse, error) {
 	var response admission.AdmissionResponse
 
-	var ok bool
-	var message string
+	var name string
+	var errs field.ErrorList
+	var warnings []string
 	var err error
 
 	switch request.Resource {
 	case kongFileGVResource:
-		plugin := developer.KongFile{}
 		deserializer := codecs.UniversalDeserializer()
-		_, _, err = deserializer.Decode(request.Object.Raw,
+		plugin := developer.KongFile{}
+		// DELETE requests only carry the object being deleted
+		raw := request.Object.Raw
+		if request.Operation == admission.Delete {
+			raw = request.OldObject.Raw
+		}
+		_, _, err = deserializer.Decode(raw,
 			nil, &plugin)
 		if err != nil {
 			return nil, err
 		}
 
-		ok, message, err = a.Validator.ValidateKongFile(ctx, plugin)
+		name = plugin.Name
+		switch request.Operation {
+		case admission.Update:
+			oldPlugin := developer.KongFile{}
+			_, _, err = deserializer.Decode(request.OldObject.Raw,
+				nil, &oldPlugin)
+			if err != nil {
+				return nil, err
+			}
+			errs, warnings, err = a.Validator.ValidateKongFileUpdate(ctx, oldPlugin, plugin)
+		case admission.Delete:
+			errs, warnings, err = a.Validator.ValidateKongFileDeletion(ctx, plugin)
+		default:
+			errs, warnings, err = a.Validator.ValidateKongFile(ctx, plugin)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -185,12 +288,17 @@ func (a RequestHandler) handleValidation(ctx context.Context, request admission.
 			request.Resource.Resource)
 	}
 	response.UID = request.UID
-	response.Allowed = ok
-	response.Result = &meta.Status{
-		Message: message,
-	}
-	if !ok {
-		response.Result.Code = 400
+	response.Allowed = len(errs) == 0
+	response.Warnings = warnings
+	response.Result = &meta.Status{}
+	switch {
+	case len(errs) > 0 && request.Operation == admission.Delete:
+		groupResource := schema.GroupResource{Group: request.Resource.Group, Resource: request.Resource.Resource}
+		response.Result = &apierrors.NewForbidden(groupResource, name, errs.ToAggregate()).ErrStatus
+	case len(errs) > 0:
+		// the Invalid status lists every failing field in its causes
+		groupKind := schema.GroupKind{Group: request.Kind.Group, Kind: request.Kind.Kind}
+		response.Result = &apierrors.NewInvalid(groupKind, name, errs).ErrStatus
 	}
 	return &response, nil
 }
@@ -0,0 +1,393 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kong/go-kong/kong"
+	admission "k8s.io/api/admission/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	services "kong-portal-controller/internal/kong"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// asyncAPISpecification is the AsyncAPI document of the cr-kongfile-spec.yaml sample.
+const asyncAPISpecification = `asyncapi: 2.0.0
+info:
+  title: Test
+  version: v1.0.0
+channels:
+  test/created:
+    subscribe:
+      message:
+        payload:
+          type: object
+`
+
+func rawKongFile(t *testing.T, kongFile *developer.KongFile) runtime.RawExtension {
+	t.Helper()
+	obj := kongFile.DeepCopy()
+	obj.APIVersion = developer.SchemeGroupVersion.String()
+	obj.Kind = "KongFile"
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: raw}
+}
+
+// admissionRequest provides the AdmissionRequest of the operation on the KongFile. UPDATE requests
+// replace the old KongFile, which is the one DELETE requests carry.
+func admissionRequest(t *testing.T, operation admission.Operation, kongFile, oldKongFile *developer.KongFile) admission.AdmissionRequest {
+	t.Helper()
+	request := admission.AdmissionRequest{
+		UID: "uid",
+		Kind: meta.GroupVersionKind{
+			Group:   developer.SchemeGroupVersion.Group,
+			Version: developer.SchemeGroupVersion.Version,
+			Kind:    "KongFile",
+		},
+		Resource:  kongFileGVResource,
+		Operation: operation,
+	}
+	if kongFile != nil {
+		request.Object = rawKongFile(t, kongFile)
+	}
+	if oldKongFile != nil {
+		request.OldObject = rawKongFile(t, oldKongFile)
+	}
+	return request
+}
+
+// validationRequest provides the request creating the KongFile, or updating it from a KongFile of another content.
+func validationRequest(t *testing.T, operation admission.Operation, kongFile *developer.KongFile) admission.AdmissionRequest {
+	t.Helper()
+	if operation != admission.Update {
+		return admissionRequest(t, operation, kongFile, nil)
+	}
+	oldKongFile := kongFile.DeepCopy()
+	oldKongFile.Spec.Content = "previous"
+	return admissionRequest(t, operation, kongFile, oldKongFile)
+}
+
+func handleValidation(t *testing.T, handler RequestHandler, request admission.AdmissionRequest) *admission.AdmissionResponse {
+	t.Helper()
+	response, err := handler.handleValidation(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handleValidation() unexpected error: %v", err)
+	}
+	if response.UID != request.UID {
+		t.Errorf("handleValidation() UID = %q, want %q", response.UID, request.UID)
+	}
+	return response
+}
+
+// causeFields provides the fields of the causes of the response status.
+func causeFields(response *admission.AdmissionResponse) []string {
+	var fields []string
+	if response.Result != nil && response.Result.Details != nil {
+		for _, cause := range response.Result.Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+	}
+	return fields
+}
+
+func testSpecificationFile(content string) *developer.KongFile {
+	obj := &developer.KongFile{Spec: developer.KongFileSpec{
+		Kind:    developer.SPECIFICATION,
+		Path:    "specs",
+		Name:    "test.yaml",
+		Content: content,
+	}}
+	obj.Namespace = "default"
+	obj.Name = "test"
+	return obj
+}
+
+func TestHandleValidationContent(t *testing.T) {
+	unquotedTitle := testContentFile("guide", "# Guide")
+	unquotedTitle.Spec.Title, unquotedTitle.Spec.Layout = "Guide: the basics", "page"
+	multilineLayout := testContentFile("guide", "# Guide")
+	multilineLayout.Spec.Title, multilineLayout.Spec.Layout = "Guide", "page\n---"
+	page := func(content string) *developer.KongFile {
+		obj := testContentFile("guide", content)
+		obj.Spec.Title, obj.Spec.Layout = "Guide", "page"
+		return obj
+	}
+
+	for _, tt := range []struct {
+		name       string
+		kongFile   *developer.KongFile
+		wantCauses []string
+	}{
+		{
+			name:     "AsyncAPI specification",
+			kongFile: testSpecificationFile(asyncAPISpecification),
+		},
+		{
+			name:     "OpenAPI specification",
+			kongFile: testSpecificationFile(`{"openapi": "3.0.3", "info": {"title": "Petstore", "version": "1.0.0"}, "paths": {}}`),
+		},
+		{
+			name:       "malformed specification",
+			kongFile:   testSpecificationFile("openapi: [3.0.3"),
+			wantCauses: []string{"spec.content"},
+		},
+		{
+			name:       "unknown specification",
+			kongFile:   testSpecificationFile("title: Petstore\n"),
+			wantCauses: []string{"spec.content"},
+		},
+		{
+			name:       "specification missing fields",
+			kongFile:   testSpecificationFile("asyncapi: 2.0.0\ninfo:\n  title: Test\n"),
+			wantCauses: []string{"spec.content.info.version", "spec.content.channels"},
+		},
+		{
+			name:       "title breaking the front matter",
+			kongFile:   unquotedTitle,
+			wantCauses: []string{"spec.title"},
+		},
+		{
+			name:       "layout spanning several lines",
+			kongFile:   multilineLayout,
+			wantCauses: []string{"spec.layout"},
+		},
+		{
+			name:     "content with a thematic break",
+			kongFile: page("# Guide\n\n---\n\nThe end.\n"),
+		},
+		{
+			name:       "content with its own front matter",
+			kongFile:   page("---\ntitle: Guide\n---\n# Guide\n"),
+			wantCauses: []string{"spec.content"},
+		},
+		{
+			name:       "content with a malformed front matter",
+			kongFile:   page("---\ntitle: [Guide\n---\n# Guide\n"),
+			wantCauses: []string{"spec.content"},
+		},
+		{
+			name:       "content with an unclosed front matter",
+			kongFile:   page("---\r\ntitle: Guide\r\n# Guide\r\n"),
+			wantCauses: []string{"spec.content"},
+		},
+	} {
+		for _, operation := range []admission.Operation{admission.Create, admission.Update} {
+			t.Run(tt.name+" "+string(operation), func(t *testing.T) {
+				handler := RequestHandler{Validator: newTestValidator(t, nil), Logger: logr.Discard()}
+
+				response := handleValidation(t, handler, validationRequest(t, operation, tt.kongFile))
+				if response.Allowed != (len(tt.wantCauses) == 0) {
+					t.Errorf("handleValidation() allowed = %t, want %t: %v", response.Allowed, len(tt.wantCauses) == 0, response.Result)
+				}
+				if causes := causeFields(response); !equalStrings(causes, tt.wantCauses) {
+					t.Errorf("handleValidation() causes = %v, want %v", causes, tt.wantCauses)
+				}
+			})
+		}
+	}
+}
+
+// layoutFileService provides the files at the provided paths, failing with err while it is set.
+type layoutFileService struct {
+	services.AbstractFileService
+	paths []string
+	err   error
+}
+
+func (s layoutFileService) Get(_ context.Context, file *services.File) (*services.File, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	for _, path := range s.paths {
+		if path == *file.Path {
+			return &services.File{ID: kong.String("id"), Path: file.Path}, nil
+		}
+	}
+	return nil, services.ErrNotFound{}
+}
+
+func TestHandleValidationLayout(t *testing.T) {
+	unavailable := kong.NewAPIError(http.StatusServiceUnavailable, "unavailable")
+	for _, tt := range []struct {
+		name          string
+		layout        string
+		layoutPolicy  LayoutPolicy
+		failurePolicy FailurePolicy
+		err           error
+		wantCauses    []string
+		wantWarning   bool
+	}{
+		{name: "existing layout", layout: "page", layoutPolicy: LayoutPolicyDeny},
+		{name: "missing layout denied", layout: "pgae", layoutPolicy: LayoutPolicyDeny, wantCauses: []string{"spec.layout"}},
+		{name: "missing layout warned", layout: "pgae", layoutPolicy: LayoutPolicyWarn, wantWarning: true},
+		{name: "missing layout ignored", layout: "pgae", layoutPolicy: LayoutPolicyIgnore},
+		{
+			name:          "Kong unreachable failing",
+			layout:        "page",
+			layoutPolicy:  LayoutPolicyDeny,
+			failurePolicy: FailurePolicyFail,
+			err:           unavailable,
+			wantCauses:    []string{"spec.layout"},
+		},
+		{
+			name:          "Kong unreachable ignored",
+			layout:        "page",
+			layoutPolicy:  LayoutPolicyDeny,
+			failurePolicy: FailurePolicyIgnore,
+			err:           unavailable,
+			wantWarning:   true,
+		},
+	} {
+		for _, operation := range []admission.Operation{admission.Create, admission.Update} {
+			t.Run(tt.name+" "+string(operation), func(t *testing.T) {
+				validator := newTestValidator(t, nil)
+				validator.FileService = layoutFileService{paths: []string{LayoutPath("base", "page")}, err: tt.err}
+				validator.LayoutPolicy, validator.FailurePolicy = tt.layoutPolicy, tt.failurePolicy
+				handler := RequestHandler{Validator: validator, Logger: logr.Discard()}
+				kongFile := testContentFile("guide", "# Guide")
+				kongFile.Spec.Title, kongFile.Spec.Layout = "Guide", tt.layout
+
+				response := handleValidation(t, handler, validationRequest(t, operation, kongFile))
+				if response.Allowed != (len(tt.wantCauses) == 0) {
+					t.Errorf("handleValidation() allowed = %t, want %t: %v", response.Allowed, len(tt.wantCauses) == 0, response.Result)
+				}
+				if causes := causeFields(response); !equalStrings(causes, tt.wantCauses) {
+					t.Errorf("handleValidation() causes = %v, want %v", causes, tt.wantCauses)
+				}
+				if warned := len(response.Warnings) > 0; warned != tt.wantWarning {
+					t.Errorf("handleValidation() warnings = %v, want a warning %t", response.Warnings, tt.wantWarning)
+				}
+			})
+		}
+	}
+}
+
+// fakeValidator records the validation called and provides the preset errors and warnings.
+type fakeValidator struct {
+	errs     field.ErrorList
+	warnings []string
+	called   *string
+}
+
+func (v fakeValidator) ValidateKongFile(context.Context, developer.KongFile) (field.ErrorList, []string, error) {
+	*v.called = "ValidateKongFile"
+	return v.errs, v.warnings, nil
+}
+
+func (v fakeValidator) ValidateKongFileUpdate(context.Context, developer.KongFile, developer.KongFile) (field.ErrorList, []string, error) {
+	*v.called = "ValidateKongFileUpdate"
+	return v.errs, v.warnings, nil
+}
+
+func (v fakeValidator) ValidateKongFileDeletion(context.Context, developer.KongFile) (field.ErrorList, []string, error) {
+	*v.called = "ValidateKongFileDeletion"
+	return v.errs, v.warnings, nil
+}
+
+func TestHandleValidationResponse(t *testing.T) {
+	specPath := field.NewPath("spec")
+	errs := field.ErrorList{
+		field.Required(specPath.Child("name"), ErrKongFileSpecNameEmpty),
+		field.Invalid(specPath.Child("path"), "guides//", "path is invalid"),
+		field.NotSupported(specPath.Child("kind"), "PAGE", supportedKinds),
+	}
+	warnings := []string{"spec.title: field is ignored by ASSET files"}
+
+	for _, tt := range []struct {
+		name       string
+		operation  admission.Operation
+		errs       field.ErrorList
+		wantCalled string
+		wantReason meta.StatusReason
+	}{
+		{name: "create allowed", operation: admission.Create, wantCalled: "ValidateKongFile"},
+		{name: "create denied", operation: admission.Create, errs: errs, wantCalled: "ValidateKongFile", wantReason: meta.StatusReasonInvalid},
+		{name: "update allowed", operation: admission.Update, wantCalled: "ValidateKongFileUpdate"},
+		{name: "update denied", operation: admission.Update, errs: errs, wantCalled: "ValidateKongFileUpdate", wantReason: meta.StatusReasonInvalid},
+		{name: "delete denied", operation: admission.Delete, errs: errs[:1], wantCalled: "ValidateKongFileDeletion", wantReason: meta.StatusReasonForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var called string
+			handler := RequestHandler{
+				Validator: fakeValidator{errs: tt.errs, warnings: warnings, called: &called},
+				Logger:    logr.Discard(),
+			}
+			kongFile := testContentFile("guide", "# Guide")
+			request := admissionRequest(t, tt.operation, kongFile, kongFile)
+			if tt.operation == admission.Create {
+				request = admissionRequest(t, tt.operation, kongFile, nil)
+			}
+
+			response := handleValidation(t, handler, request)
+			if called != tt.wantCalled {
+				t.Errorf("handleValidation() called %s, want %s", called, tt.wantCalled)
+			}
+			if response.Allowed != (len(tt.errs) == 0) {
+				t.Errorf("handleValidation() allowed = %t, want %t", response.Allowed, len(tt.errs) == 0)
+			}
+			// the warnings are returned whether the request is allowed or not
+			if !equalStrings(response.Warnings, warnings) {
+				t.Errorf("handleValidation() warnings = %v, want %v", response.Warnings, warnings)
+			}
+			if response.Result.Reason != tt.wantReason {
+				t.Errorf("handleValidation() reason = %q, want %q", response.Result.Reason, tt.wantReason)
+			}
+			if tt.wantReason != meta.StatusReasonInvalid {
+				return
+			}
+			// every failing field is reported at once, with its path
+			if response.Result.Details == nil || response.Result.Details.Name != "guide" || response.Result.Details.Kind != "KongFile" {
+				t.Errorf("handleValidation() details = %+v, want the ones of KongFile guide", response.Result.Details)
+			}
+			if causes, want := causeFields(response), []string{"spec.name", "spec.path", "spec.kind"}; !equalStrings(causes, want) {
+				t.Errorf("handleValidation() causes = %v, want %v", causes, want)
+			}
+			for i, cause := range response.Result.Details.Causes {
+				if cause.Type != meta.CauseType(tt.errs[i].Type) {
+					t.Errorf("handleValidation() cause %s type = %q, want %q", cause.Field, cause.Type, tt.errs[i].Type)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleValidationAggregatesErrors(t *testing.T) {
+	kongFile := &developer.KongFile{Spec: developer.KongFileSpec{Kind: developer.CONTENT}}
+	kongFile.Namespace = "default"
+
+	for _, operation := range []admission.Operation{admission.Create, admission.Update} {
+		t.Run(string(operation), func(t *testing.T) {
+			handler := RequestHandler{Validator: newTestValidator(t, nil), Logger: logr.Discard()}
+
+			response := handleValidation(t, handler, validationRequest(t, operation, kongFile))
+			if response.Allowed {
+				t.Fatalf("handleValidation() allowed a KongFile without any field")
+			}
+			want := []string{"metadata.name", "spec.name", "spec.path", "spec.title", "spec.layout"}
+			if causes := causeFields(response); !equalStrings(causes, want) {
+				t.Errorf("handleValidation() causes = %v, want %v", causes, want)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
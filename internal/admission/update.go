@@ -0,0 +1,186 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kong-portal-controller/internal/annotations"
+	"kong-portal-controller/internal/dataplane/proxy"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// ValidateKongFileUpdate checks if an update of the developer CRD is allowed, on top of the validation
+// of the updated KongFile. Updates leaving the spec as is, such as the ones of the finalizers or the removal
+// of the lock, are always allowed.
+func (validator KongHTTPValidator) ValidateKongFileUpdate(
+	ctx context.Context,
+	oldKongFile developer.KongFile,
+	kongFile developer.KongFile,
+) (field.ErrorList, []string, error) {
+	if equality.Semantic.DeepEqual(oldKongFile.Spec, kongFile.Spec) || kongFile.DeletionTimestamp != nil {
+		return nil, nil, nil
+	}
+
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	// a locked KongFile keeps its spec, unlocking it is a separate update leaving the spec as is
+	if isLocked(oldKongFile) {
+		allErrs = append(allErrs, field.Forbidden(specPath, fmt.Sprintf(ErrKongFileLocked, annotations.LockedKey)))
+	}
+	if validator.ImmutableKind {
+		allErrs = append(allErrs, apivalidation.ValidateImmutableField(kongFile.Spec.Kind, oldKongFile.Spec.Kind, specPath.Child("kind"))...)
+	}
+	oldPath, oldErr := proxy.BuildPath(&oldKongFile)
+	path, err := proxy.BuildPath(&kongFile)
+	if oldErr == nil && err == nil && oldPath != path && kongFile.Annotations[annotations.AllowMoveKey] != "true" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("path"),
+			fmt.Sprintf(ErrKongFileMoveForbidden, oldPath, path, annotations.AllowMoveKey)))
+	}
+
+	errs, warnings, err := validator.ValidateKongFile(ctx, kongFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(allErrs, errs...), warnings, nil
+}
+
+// ValidateKongFileDeletion checks if the developer CRD can be deleted: locked KongFiles cannot be,
+// nor the assets which are referenced by CONTENT KongFiles or by the layouts of the portal theme.
+func (validator KongHTTPValidator) ValidateKongFileDeletion(
+	ctx context.Context,
+	kongFile developer.KongFile,
+) (field.ErrorList, []string, error) {
+	validator.Logger.Info("Validating resource deletion", "namespace", kongFile.Namespace, "name", kongFile.Name)
+	var allErrs field.ErrorList
+	if isLocked(kongFile) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("metadata", "annotations").Key(annotations.LockedKey),
+			fmt.Sprintf(ErrKongFileLocked, annotations.LockedKey)))
+	}
+	if !validator.DeleteProtection || kongFile.Spec.Kind != developer.ASSET {
+		return allErrs, nil, nil
+	}
+
+	path, err := proxy.BuildPath(&kongFile)
+	if err != nil {
+		// the asset was never published, nothing can link to it
+		return allErrs, nil, nil
+	}
+	reference := AssetReference(path)
+
+	var warnings []string
+	referrers, err := validator.referringKongFiles(ctx, kongFile, reference)
+	if err != nil {
+		// the deletion is not blocked by a lookup failure, only reported
+		validator.Logger.Error(err, "Failed to list the KongFiles referencing the asset", "namespace", kongFile.Namespace, "name", kongFile.Name)
+		warnings = append(warnings, fmt.Sprintf(ErrKongFileReferencesUnchecked, err))
+	}
+	layouts, err := validator.referringLayouts(ctx, reference)
+	if err != nil {
+		validator.Logger.Error(err, "Failed to fetch layouts from Kong", "theme", validator.Theme)
+		fieldErr := field.Forbidden(field.NewPath("spec"), fmt.Sprintf(ErrKongFileReferencesUnverifiable, err))
+		if validator.FailurePolicy == FailurePolicyIgnore {
+			warnings = append(warnings, fieldErr.Error())
+		} else {
+			allErrs = append(allErrs, fieldErr)
+		}
+	}
+	for _, referrer := range append(referrers, layouts...) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), fmt.Sprintf(ErrKongFileReferenced, path, referrer)))
+	}
+	return allErrs, warnings, nil
+}
+
+// AssetReference provides the path by which the portal pages link to an asset published at the path in Kong.
+func AssetReference(path string) string {
+	return strings.TrimPrefix(path, "base/")
+}
+
+// referringKongFiles provides the CONTENT KongFiles of the same controller class linking to the reference,
+// leaving out the ones being deleted. Only inline contents are checked: reading the ConfigMaps, Secrets or
+// files of every KongFile would slow every deletion down.
+func (validator KongHTTPValidator) referringKongFiles(
+	ctx context.Context,
+	kongFile developer.KongFile,
+	reference string,
+) ([]string, error) {
+	kongFiles := new(developer.KongFileList)
+	if err := validator.ManagerClient.List(ctx, kongFiles); err != nil {
+		return nil, fmt.Errorf("failed to list KongFiles: %w", err)
+	}
+
+	class := kongFile.Annotations[annotations.ControllerClassKey]
+	var referrers []string
+	for _, existing := range kongFiles.Items {
+		if existing.Spec.Kind != developer.CONTENT || existing.Spec.ContentFrom != nil || existing.DeletionTimestamp != nil ||
+			existing.Annotations[annotations.ControllerClassKey] != class {
+			continue
+		}
+		content, err := proxy.DecodeContent(existing.Spec.ContentEncoding, []byte(existing.Spec.Content))
+		if err != nil {
+			// the content cannot be checked until it decodes
+			continue
+		}
+		if referencesPath(string(content), reference) {
+			referrers = append(referrers, "KongFile "+client.ObjectKeyFromObject(&existing).String())
+		}
+	}
+	return referrers, nil
+}
+
+// referringLayouts provides the layouts of the portal theme in Kong linking to the reference.
+func (validator KongHTTPValidator) referringLayouts(ctx context.Context, reference string) ([]string, error) {
+	if validator.FileService == nil {
+		return nil, nil
+	}
+
+	layouts, err := validator.FileService.ListAll(ctx, LayoutPath(validator.Theme, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	var referrers []string
+	for _, layout := range layouts {
+		if layout.Path != nil && layout.Contents != nil && referencesPath(*layout.Contents, reference) {
+			referrers = append(referrers, "layout "+*layout.Path)
+		}
+	}
+	return referrers, nil
+}
+
+// referencesPath indicates whether the content links to the reference as a whole path, optionally preceded
+// by a slash: "/assets/a.css" in a quoted or delimited link refers to assets/a.css, while "assets/a.css.map"
+// or "other/assets/a.css" do not.
+func referencesPath(content, reference string) bool {
+	for offset := 0; offset < len(content); {
+		i := strings.Index(content[offset:], reference)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(reference)
+		if start > 0 && content[start-1] == '/' {
+			start--
+		}
+		if (start == 0 || !isPathChar(content[start-1])) && (end == len(content) || !isPathChar(content[end])) {
+			return true
+		}
+		offset += i + 1
+	}
+	return false
+}
+
+// isPathChar indicates whether the character can be part of a path, as opposed to the quotes, spaces, brackets
+// or query and fragment separators delimiting a link.
+func isPathChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("._-/~%+", c) >= 0
+}
+
+// isLocked indicates whether the KongFile is locked by its annotation.
+func isLocked(kongFile developer.KongFile) bool {
+	return kongFile.Annotations[annotations.LockedKey] == "true"
+}
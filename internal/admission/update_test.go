@@ -0,0 +1,114 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kong-portal-controller/internal/dataplane/proxy"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+func TestReferencesPath(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "double quoted", content: `<img src="assets/images/logo.png">`, want: true},
+		{name: "single quoted with a leading slash", content: `<img src='/assets/images/logo.png'>`, want: true},
+		{name: "markdown link", content: `![logo](/assets/images/logo.png)`, want: true},
+		{name: "css url", content: `background: url(assets/images/logo.png);`, want: true},
+		{name: "query string", content: `"/assets/images/logo.png?v=2"`, want: true},
+		{name: "fragment", content: `"/assets/images/logo.png#top"`, want: true},
+		{name: "whole content", content: `assets/images/logo.png`, want: true},
+		{name: "later occurrence", content: `"/assets/images/logo.png.map" "/assets/images/logo.png"`, want: true},
+		{name: "longer name", content: `"/assets/images/logo.png.map"`},
+		{name: "longer directory", content: `"/other/assets/images/logo.png"`},
+		{name: "prefix of the name", content: `"/assets/images/my-logo.png"`},
+		{name: "double slash", content: `"//assets/images/logo.png"`},
+		{name: "no reference", content: `# Guide`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := referencesPath(tt.content, "assets/images/logo.png"); got != tt.want {
+				t.Errorf("referencesPath(%q) = %t, want %t", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingListClient is a client failing to list objects.
+type failingListClient struct {
+	client.Client
+}
+
+func (c failingListClient) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("cache not synced")
+}
+
+func testContentFile(name, content string) *developer.KongFile {
+	obj := &developer.KongFile{Spec: developer.KongFileSpec{Kind: developer.CONTENT, Path: "guides", Name: name + ".md", Content: content}}
+	obj.Namespace = "default"
+	obj.Name = name
+	return obj
+}
+
+func TestValidateKongFileDeletion(t *testing.T) {
+	encoded, err := proxy.EncodeContent(developer.ContentEncodingGzipBase64, []byte(`![logo](/assets/images/logo.png)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := testContentFile("compressed", string(encoded))
+	compressed.Spec.ContentEncoding = developer.ContentEncodingGzipBase64
+	fromConfigMap := testContentFile("from-configmap", "")
+	fromConfigMap.Spec.ContentFrom = &developer.KongFileContentSource{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "guide"}, Key: "guide.md"},
+	}
+	configMap := &corev1.ConfigMap{Data: map[string]string{"guide.md": `![logo](/assets/images/logo.png)`}}
+	configMap.Namespace = "default"
+	configMap.Name = "guide"
+	asset := developer.KongFile{Spec: developer.KongFileSpec{Kind: developer.ASSET, Path: "images", Name: "logo.png"}}
+	asset.Namespace = "default"
+	asset.Name = "logo"
+
+	for _, tt := range []struct {
+		name         string
+		objects      []client.Object
+		failList     bool
+		wantErrs     int
+		wantWarnings int
+	}{
+		{name: "not referenced", objects: []client.Object{testContentFile("guide", `![logo](/assets/images/logo.png.map)`)}},
+		{name: "referenced inline", objects: []client.Object{testContentFile("guide", `![logo](/assets/images/logo.png)`)}, wantErrs: 1},
+		{name: "referenced by compressed content", objects: []client.Object{compressed}, wantErrs: 1},
+		{name: "content from a ConfigMap is not read", objects: []client.Object{fromConfigMap, configMap}},
+		{name: "lookup failure", failList: true, wantWarnings: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newTestValidator(t, nil, tt.objects...)
+			if tt.failList {
+				validator.ManagerClient = failingListClient{validator.ManagerClient}
+			}
+
+			errs, warnings, err := validator.ValidateKongFileDeletion(context.Background(), asset)
+			if err != nil {
+				t.Fatalf("ValidateKongFileDeletion() unexpected error: %v", err)
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("ValidateKongFileDeletion() = %v, want %d errors", errs, tt.wantErrs)
+			}
+			for _, fieldErr := range errs {
+				if fieldErr.Type != field.ErrorTypeForbidden {
+					t.Errorf("ValidateKongFileDeletion() error type = %s, want %s", fieldErr.Type, field.ErrorTypeForbidden)
+				}
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("ValidateKongFileDeletion() warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
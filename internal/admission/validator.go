@@ -2,15 +2,32 @@ package admission
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"kong-portal-controller/internal/annotations"
+	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
 	developer "kong-portal-controller/pkg/apis/v1"
 )
 
 // KongValidator validates Kong entities.
 type KongValidator interface {
-	ValidateKongFile(ctx context.Context, plugin developer.KongFile) (bool, string, error)
+	// ValidateKongFile provides every field of the KongFile failing validation, the KongFile being valid
+	// when there is none, and the warnings to return to the client in both cases.
+	ValidateKongFile(ctx context.Context, plugin developer.KongFile) (field.ErrorList, []string, error)
+
+	// ValidateKongFileUpdate provides the fields of the updated KongFile failing validation, including
+	// the ones the update is not allowed to change, and the warnings to return to the client.
+	ValidateKongFileUpdate(ctx context.Context, oldPlugin, plugin developer.KongFile) (field.ErrorList, []string, error)
+
+	// ValidateKongFileDeletion provides the reasons why the KongFile cannot be deleted, if any,
+	// and the warnings to return to the client.
+	ValidateKongFileDeletion(ctx context.Context, plugin developer.KongFile) (field.ErrorList, []string, error)
 }
 
 // KongHTTPValidator implements KongValidator interface to validate Kong
@@ -18,6 +35,23 @@ type KongValidator interface {
 type KongHTTPValidator struct {
 	Logger        logr.Logger
 	ManagerClient client.Client
+	// APIReader reads the ConfigMaps and Secrets KongFiles read their content from, which are not cached
+	APIReader   client.Reader
+	FileService services.AbstractFileService
+	SizeLimits  proxy.SizeLimits
+
+	// Theme is the portal theme whose layouts CONTENT KongFiles are checked against
+	Theme         string
+	LayoutPolicy  LayoutPolicy
+	FailurePolicy FailurePolicy
+
+	// ImmutableKind denies the updates changing the kind of a KongFile
+	ImmutableKind bool
+	// DeleteProtection denies the deletion of the assets referenced by other files
+	DeleteProtection bool
+
+	// ContentRoot is the directory the spec.contentFrom.file of KongFiles are read from
+	ContentRoot string
 }
 
 // NewKongHTTPValidator provides a new KongHTTPValidator object provided a
@@ -27,35 +61,178 @@ type KongHTTPValidator struct {
 func NewKongHTTPValidator(
 	logger logr.Logger,
 	managerClient client.Client,
+	apiReader client.Reader,
+	fileService services.AbstractFileService,
+	sizeLimits proxy.SizeLimits,
+	theme string,
+	layoutPolicy LayoutPolicy,
+	failurePolicy FailurePolicy,
+	immutableKind bool,
+	deleteProtection bool,
+	contentRoot string,
 ) KongHTTPValidator {
 	return KongHTTPValidator{
 		Logger:        logger,
 		ManagerClient: managerClient,
+		APIReader:     apiReader,
+		FileService:   fileService,
+		SizeLimits:    sizeLimits,
+		Theme:         theme,
+		LayoutPolicy:  layoutPolicy,
+		FailurePolicy: failurePolicy,
+
+		ImmutableKind:    immutableKind,
+		DeleteProtection: deleteProtection,
+		ContentRoot:      contentRoot,
 	}
 }
 
-// ValidateKongFile checks if the developer CRD is valid.
+// LargeAssetSize is the size of ASSET file contents, in bytes, above which the client is warned.
+const LargeAssetSize = 1 << 20
+
+// supportedKinds are the kinds of KongFiles, in the order they are reported to the client.
+var supportedKinds = []string{string(developer.CONTENT), developer.SPECIFICATION, developer.ASSET}
+
+// ValidateKongFile checks if the developer CRD is valid, reporting all the failing fields at once.
 func (validator KongHTTPValidator) ValidateKongFile(
 	ctx context.Context,
 	kongFile developer.KongFile,
-) (bool, string, error) {
+) (field.ErrorList, []string, error) {
 	validator.Logger.Info("Validating resource", "namespace", kongFile.Namespace, "name", kongFile.Name)
+	var allErrs field.ErrorList
+	var warnings []string
+
 	if kongFile.Name == "" {
-		return false, ErrKongFileNameEmpty, nil
+		allErrs = append(allErrs, field.Required(field.NewPath("metadata", "name"), ErrKongFileNameEmpty))
 	}
+
+	specPath := field.NewPath("spec")
+	metadataErrs := len(allErrs)
 	if kongFile.Spec.Name == "" {
-		return false, ErrKongFileSpecNameEmpty, nil
+		allErrs = append(allErrs, field.Required(specPath.Child("name"), ErrKongFileSpecNameEmpty))
+	} else if err := proxy.ValidateName(kongFile.Spec.Name); err != nil {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("name"), kongFile.Spec.Name, err.Error()))
 	}
 	if kongFile.Spec.Path == "" {
-		return false, ErrKongFileSpecPathEmpty, nil
+		allErrs = append(allErrs, field.Required(specPath.Child("path"), ErrKongFileSpecPathEmpty))
+	} else if err := proxy.ValidatePath(kongFile.Spec.Path); err != nil {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("path"), kongFile.Spec.Path, err.Error()))
 	}
-	if kongFile.Spec.Kind == developer.CONTENT {
+
+	switch kongFile.Spec.Kind {
+	case developer.CONTENT:
 		if kongFile.Spec.Title == "" {
-			return false, ErrKongFileSpecTitleEmpty, nil
+			allErrs = append(allErrs, field.Required(specPath.Child("title"), ErrKongFileSpecTitleEmpty))
 		}
 		if kongFile.Spec.Layout == "" {
-			return false, ErrKongFileSpecLayoutEmpty, nil
+			allErrs = append(allErrs, field.Required(specPath.Child("layout"), ErrKongFileSpecLayoutEmpty))
+		}
+	case developer.SPECIFICATION, developer.ASSET:
+		if kongFile.Spec.Title != "" {
+			warnings = append(warnings, fmt.Sprintf(WarnKongFileFieldIgnored, specPath.Child("title"), kongFile.Spec.Kind))
+		}
+		if kongFile.Spec.Layout != "" {
+			warnings = append(warnings, fmt.Sprintf(WarnKongFileFieldIgnored, specPath.Child("layout"), kongFile.Spec.Kind))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("kind"), kongFile.Spec.Kind, supportedKinds))
+	}
+
+	// the content read from spec.contentFrom is checked as the inline one, unless it cannot be read yet
+	contentFromErrs := validateContentSource(kongFile.Spec, validator.ContentRoot, specPath)
+	allErrs = append(allErrs, contentFromErrs...)
+	contentResolved := len(contentFromErrs) == 0
+	if (kongFile.Spec.ContentFrom != nil || kongFile.Spec.ContentEncoding != "") && contentResolved {
+		resolved, err := proxy.ResolveContent(ctx, validator.APIReader, validator.ContentRoot, &kongFile)
+		var refErr *proxy.ContentRefError
+		var encodingErr *proxy.ContentEncodingError
+		if errors.As(err, &encodingErr) && kongFile.Spec.ContentFrom == nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("content"), omittedValue(len(kongFile.Spec.Content)), encodingErr.Error()))
+			contentResolved = false
+		} else if errors.Is(err, proxy.ErrSecretNotContentSource) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("contentFrom", "secretKeyRef"), err.Error()))
+			contentResolved = false
+		} else if errors.As(err, &refErr) || errors.As(err, &encodingErr) {
+			warnings = append(warnings, fmt.Sprintf(WarnKongFileContentFrom, specPath.Child("contentFrom"), err))
+			contentResolved = false
+		} else if err != nil {
+			return nil, nil, err
+		} else {
+			kongFile = *resolved
+		}
+	}
+	if len(kongFile.Spec.BinaryContent) > 0 && contentResolved {
+		if fieldErr := validateContentType(kongFile.Spec, specPath.Child("name")); fieldErr != nil {
+			allErrs = append(allErrs, fieldErr)
+		}
+	}
+	if kongFile.Spec.Kind == developer.SPECIFICATION && contentResolved {
+		allErrs = append(allErrs, validateSpecification(kongFile.Spec.Content, specPath.Child("content"))...)
+	}
+	if size := len(kongFile.Spec.Content) + len(kongFile.Spec.BinaryContent); kongFile.Spec.Kind == developer.ASSET && size > LargeAssetSize {
+		warnings = append(warnings, fmt.Sprintf(WarnKongFileLargeAsset, specPath.Child("content"), size))
+	}
+
+	// the checks below need the file as published in Kong, which cannot be built from an invalid spec
+	if len(allErrs) > metadataErrs {
+		return allErrs, warnings, nil
+	}
+	file, err := proxy.Build(&kongFile)
+	if err != nil {
+		return append(allErrs, field.Invalid(specPath, nil, err.Error())), warnings, nil
+	}
+	size := proxy.ContentSize(&kongFile.Spec, *file.Contents)
+	if limit, ok := validator.SizeLimits[kongFile.Spec.Kind]; ok && contentResolved && int64(size) > limit {
+		allErrs = append(allErrs, field.TooLong(specPath.Child("content"), omittedValue(size), int(limit)))
+	}
+	fieldErr, err := validator.validateKongPath(ctx, kongFile, *file.Path, specPath.Child("path"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if fieldErr != nil {
+		allErrs = append(allErrs, fieldErr)
+	}
+	if kongFile.Spec.Kind == developer.CONTENT {
+		frontMatterErrs := validateFrontMatter(kongFile, *file.Contents, specPath)
+		allErrs = append(allErrs, frontMatterErrs...)
+		if len(frontMatterErrs) == 0 {
+			fieldErr, layoutWarnings := validator.validateLayout(ctx, kongFile, specPath.Child("layout"))
+			if fieldErr != nil {
+				allErrs = append(allErrs, fieldErr)
+			}
+			warnings = append(warnings, layoutWarnings...)
+		}
+	}
+	return allErrs, warnings, nil
+}
+
+// validateKongPath checks that no KongFile of the same controller class owns the path in Kong before the KongFile,
+// using the manager cache index of KongFiles by Kong path: the KongFile publishing a file at the path, as recorded
+// in its status, owns it regardless of its age, otherwise the oldest KongFile does, see proxy.OwnsPathBefore.
+func (validator KongHTTPValidator) validateKongPath(
+	ctx context.Context,
+	kongFile developer.KongFile,
+	path string,
+	fieldPath *field.Path,
+) (*field.Error, error) {
+	kongFiles := new(developer.KongFileList)
+	if err := validator.ManagerClient.List(ctx, kongFiles, client.MatchingFields{proxy.KongPathIndexKey: path}); err != nil {
+		return nil, fmt.Errorf("failed to list KongFiles publishing %q: %w", path, err)
+	}
+
+	class := kongFile.Annotations[annotations.ControllerClassKey]
+	for _, existing := range kongFiles.Items {
+		if existing.Namespace == kongFile.Namespace && existing.Name == kongFile.Name {
+			continue
+		}
+		if existing.Annotations[annotations.ControllerClassKey] != class {
+			continue
+		}
+		if !proxy.OwnsPathBefore(&existing, &kongFile, path) {
+			continue
 		}
+		return field.Invalid(fieldPath, kongFile.Spec.Path,
+			fmt.Sprintf(ErrKongFilePathConflict, path, existing.Namespace, existing.Name)), nil
 	}
-	return true, "", nil
+	return nil, nil
 }
@@ -0,0 +1,243 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kong-portal-controller/internal/annotations"
+	"kong-portal-controller/internal/dataplane/proxy"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// newTestValidator provides a validator of KongFiles which are checked against the provided objects,
+// without a Kong Admin API.
+func newTestValidator(t *testing.T, sizeLimits proxy.SizeLimits, objects ...client.Object) KongHTTPValidator {
+	t.Helper()
+	testScheme := runtime.NewScheme()
+	if err := developer.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := indexedClient{fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).Build()}
+	return NewKongHTTPValidator(logr.Discard(), kubeClient, kubeClient, nil, sizeLimits,
+		"base", LayoutPolicyDeny, FailurePolicyFail, true, true, "")
+}
+
+// indexedClient lists KongFiles by their Kong path as the manager cache index does, which the fake client ignores.
+type indexedClient struct {
+	client.Client
+}
+
+func (c indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	fieldSelector := listOpts.FieldSelector
+	listOpts.FieldSelector = nil
+	if err := c.Client.List(ctx, list, listOpts); err != nil {
+		return err
+	}
+	kongFiles, ok := list.(*developer.KongFileList)
+	if !ok || fieldSelector == nil {
+		return nil
+	}
+	path, _ := fieldSelector.RequiresExactMatch(proxy.KongPathIndexKey)
+	items := kongFiles.Items[:0]
+	for i := range kongFiles.Items {
+		for _, indexed := range proxy.KongPathIndexer(&kongFiles.Items[i]) {
+			if indexed == path {
+				items = append(items, kongFiles.Items[i])
+				break
+			}
+		}
+	}
+	kongFiles.Items = items
+	return nil
+}
+
+// specificationOfSize provides an OpenAPI document of exactly the provided size, in bytes.
+func specificationOfSize(t *testing.T, size int) string {
+	t.Helper()
+	document := "openapi: 3.0.0\ninfo:\n  title: Petstore\n  version: 1.0.0\npaths: {}\nx-padding: "
+	if size < len(document) {
+		t.Fatalf("cannot build a specification of %d bytes", size)
+	}
+	return document + strings.Repeat("a", size-len(document))
+}
+
+func TestValidateKongFileSizeLimit(t *testing.T) {
+	const limit = 4096
+	validator := newTestValidator(t, proxy.SizeLimits{developer.SPECIFICATION: limit})
+
+	for _, tt := range []struct {
+		name     string
+		size     int
+		encoding developer.ContentEncoding
+		wantErr  bool
+	}{
+		{name: "plain at the limit", size: limit},
+		{name: "plain above the limit", size: limit + 1, wantErr: true},
+		{name: "compressed at the limit", size: limit, encoding: developer.ContentEncodingGzipBase64},
+		{name: "compressed above the limit", size: limit + 1, encoding: developer.ContentEncodingGzipBase64, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := proxy.EncodeContent(tt.encoding, []byte(specificationOfSize(t, tt.size)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.encoding != "" && len(content) >= limit {
+				t.Fatalf("compressed content of %d bytes is not below the limit", len(content))
+			}
+			kongFile := developer.KongFile{Spec: developer.KongFileSpec{
+				Kind:            developer.SPECIFICATION,
+				Path:            "apis",
+				Name:            "petstore.yaml",
+				Content:         string(content),
+				ContentEncoding: tt.encoding,
+			}}
+			kongFile.Name = "petstore"
+
+			errs, _, err := validator.ValidateKongFile(context.Background(), kongFile)
+			if err != nil {
+				t.Fatalf("ValidateKongFile() unexpected error: %v", err)
+			}
+			tooLong := false
+			for _, fieldErr := range errs {
+				if fieldErr.Type == field.ErrorTypeTooLong && fieldErr.Field == "spec.content" {
+					tooLong = true
+				}
+			}
+			if tooLong != tt.wantErr || (!tt.wantErr && len(errs) > 0) {
+				t.Errorf("ValidateKongFile() = %v, want a spec.content size error %t", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateKongFileBinarySizeLimit(t *testing.T) {
+	const limit = 4096
+	validator := newTestValidator(t, proxy.SizeLimits{developer.ASSET: limit})
+
+	for _, tt := range []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		// the data URL of the contents at the limit is a third larger
+		{name: "at the limit", size: limit},
+		{name: "above the limit", size: limit + 1, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kongFile := developer.KongFile{Spec: developer.KongFileSpec{
+				Kind:          developer.ASSET,
+				Path:          "images",
+				Name:          "logo.png",
+				BinaryContent: append(append([]byte{}, pngHeader...), make([]byte, tt.size-len(pngHeader))...),
+			}}
+			kongFile.Name = "logo"
+
+			errs, _, err := validator.ValidateKongFile(context.Background(), kongFile)
+			if err != nil {
+				t.Fatalf("ValidateKongFile() unexpected error: %v", err)
+			}
+			tooLong := false
+			for _, fieldErr := range errs {
+				if fieldErr.Type == field.ErrorTypeTooLong {
+					tooLong = true
+				}
+			}
+			if tooLong != tt.wantErr || (!tt.wantErr && len(errs) > 0) {
+				t.Errorf("ValidateKongFile() = %v, want a size error %t", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateKongPath(t *testing.T) {
+	const path = "content/guides/guide.md"
+	created := metav1.NewTime(time.Date(2022, 4, 15, 0, 0, 0, 0, time.UTC))
+	guide := func(namespace, class string, creationTimestamp metav1.Time) *developer.KongFile {
+		obj := testContentFile("guide", "# Guide")
+		obj.Namespace = namespace
+		obj.CreationTimestamp = creationTimestamp
+		obj.Annotations = map[string]string{annotations.ControllerClassKey: class}
+		return obj
+	}
+	published := func(obj *developer.KongFile) *developer.KongFile {
+		obj.Status.Path = path
+		return obj
+	}
+	elsewhere := guide("default", "kong", created)
+	elsewhere.Name = "other-guide"
+	elsewhere.Spec.Path = "other-guides"
+
+	for _, tt := range []struct {
+		name     string
+		kongFile *developer.KongFile
+		existing []client.Object
+		wantErr  string
+	}{
+		{
+			name:     "create without other owner",
+			kongFile: guide("default", "kong", metav1.Time{}),
+			existing: []client.Object{elsewhere},
+		},
+		{
+			name:     "create colliding with an older owner in another namespace",
+			kongFile: guide("default", "kong", metav1.Time{}),
+			existing: []client.Object{guide("team", "kong", created)},
+			wantErr:  fmt.Sprintf(ErrKongFilePathConflict, path, "team", "guide"),
+		},
+		{
+			name:     "create colliding with an owner of another controller class",
+			kongFile: guide("default", "kong", metav1.Time{}),
+			existing: []client.Object{published(guide("team", "other", created))},
+		},
+		{
+			name:     "update colliding with a newer owner in another namespace",
+			kongFile: guide("default", "kong", created),
+			existing: []client.Object{guide("team", "kong", metav1.NewTime(created.Add(time.Hour)))},
+		},
+		{
+			name:     "update colliding with a newer owner publishing the path",
+			kongFile: guide("default", "kong", created),
+			existing: []client.Object{published(guide("team", "kong", metav1.NewTime(created.Add(time.Hour))))},
+			wantErr:  fmt.Sprintf(ErrKongFilePathConflict, path, "team", "guide"),
+		},
+		{
+			// the cached KongFile publishes the path before its update
+			name:     "update of the owner",
+			kongFile: guide("default", "kong", created),
+			existing: []client.Object{published(guide("default", "kong", created))},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newTestValidator(t, nil, tt.existing...)
+
+			fieldErr, err := validator.validateKongPath(context.Background(), *tt.kongFile, path, field.NewPath("spec", "path"))
+			if err != nil {
+				t.Fatalf("validateKongPath() unexpected error: %v", err)
+			}
+			if tt.wantErr == "" {
+				if fieldErr != nil {
+					t.Errorf("validateKongPath() = %v, want no error", fieldErr)
+				}
+				return
+			}
+			if fieldErr == nil || fieldErr.Type != field.ErrorTypeInvalid || fieldErr.Field != "spec.path" || fieldErr.Detail != tt.wantErr {
+				t.Errorf("validateKongPath() = %v, want spec.path invalid: %s", fieldErr, tt.wantErr)
+			}
+		})
+	}
+}
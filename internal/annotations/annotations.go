@@ -29,6 +29,18 @@ const (
 const (
 	ControllerClassKey = AnnotationPrefix + "/controller.class"
 
+	// DriftPolicyKey overrides the controller drift policy for an object.
+	DriftPolicyKey = AnnotationPrefix + "/drift-policy"
+
+	// LockedKey denies the edits of the spec of an object, and its deletion, when set to "true".
+	LockedKey = AnnotationPrefix + "/locked"
+
+	// AllowMoveKey allows an update to move the file of an object to another path in Kong when set to "true".
+	AllowMoveKey = AnnotationPrefix + "/allow-move"
+
+	// ContentSourceKey allows KongFiles to publish the data of a Secret when set to "true".
+	ContentSourceKey = AnnotationPrefix + "/content-source"
+
 	AnnotationPrefix = "developer.konghq.com"
 
 	// DefaultControllerClass defines the default class used
@@ -0,0 +1,222 @@
+// Package certwatch loads TLS material from files and reloads it when the files change on disk,
+// such as when the Secrets they are mounted from are rotated.
+package certwatch
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"kong-portal-controller/internal/metrics"
+)
+
+// promMetrics are shared by all the certificates, so that the metrics are registered once.
+var promMetrics = metrics.NewCertificateMetrics()
+
+// ObserveExpiry records the expiry of the named certificate.
+func ObserveExpiry(name string, notAfter time.Time) {
+	promMetrics.CertificateExpiry.WithLabelValues(name).Set(float64(notAfter.Unix()))
+}
+
+// Reloadable is TLS material loaded from files.
+type Reloadable interface {
+	// Name describes the TLS material in logs and metrics.
+	Name() string
+	// Paths are the files the TLS material is loaded from.
+	Paths() []string
+	// Reload loads the files again, indicating whether they changed since the last load.
+	// The TLS material in use is kept when the files cannot be loaded.
+	Reload() (bool, error)
+}
+
+// -----------------------------------------------------------------------------
+// Key Pair
+// -----------------------------------------------------------------------------
+
+// KeyPair is a certificate and its private key loaded from PEM files.
+type KeyPair struct {
+	name     string
+	certPath string
+	keyPath  string
+
+	lock        sync.RWMutex
+	certPEM     []byte
+	keyPEM      []byte
+	certificate *tls.Certificate
+}
+
+var _ Reloadable = &KeyPair{}
+
+// NewKeyPair loads the named key pair from the PEM files.
+func NewKeyPair(name, certPath, keyPath string) (*KeyPair, error) {
+	keyPair := &KeyPair{name: name, certPath: certPath, keyPath: keyPath}
+	if _, err := keyPair.Reload(); err != nil {
+		return nil, err
+	}
+	return keyPair, nil
+}
+
+func (kp *KeyPair) Name() string {
+	return kp.name
+}
+
+func (kp *KeyPair) Paths() []string {
+	return []string{kp.certPath, kp.keyPath}
+}
+
+func (kp *KeyPair) Reload() (bool, error) {
+	certPEM, err := os.ReadFile(kp.certPath)
+	if err != nil {
+		return false, fmt.Errorf("read cert from file %q: %w", kp.certPath, err)
+	}
+	keyPEM, err := os.ReadFile(kp.keyPath)
+	if err != nil {
+		return false, fmt.Errorf("read key from file %q: %w", kp.keyPath, err)
+	}
+
+	kp.lock.Lock()
+	defer kp.lock.Unlock()
+	if kp.certificate != nil && bytes.Equal(certPEM, kp.certPEM) && bytes.Equal(keyPEM, kp.keyPEM) {
+		return false, nil
+	}
+	certificate, err := ParseKeyPair(kp.name, certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	kp.certPEM, kp.keyPEM, kp.certificate = certPEM, keyPEM, certificate
+	return true, nil
+}
+
+// GetCertificate provides the current certificate to the TLS handshakes of a server.
+func (kp *KeyPair) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.lock.RLock()
+	defer kp.lock.RUnlock()
+	return kp.certificate, nil
+}
+
+// GetClientCertificate provides the current certificate to the TLS handshakes of a client.
+func (kp *KeyPair) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	kp.lock.RLock()
+	defer kp.lock.RUnlock()
+	return kp.certificate, nil
+}
+
+// ParseKeyPair parses the named PEM encoded certificate and private key, recording the certificate expiry.
+func ParseKeyPair(name string, certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("X509KeyPair error: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	certificate.Leaf = leaf
+	ObserveExpiry(name, leaf.NotAfter)
+	return &certificate, nil
+}
+
+// -----------------------------------------------------------------------------
+// Cert Pool
+// -----------------------------------------------------------------------------
+
+// CertPool is a pool of CA certificates loaded from a PEM file.
+type CertPool struct {
+	name string
+	path string
+
+	lock     sync.RWMutex
+	pem      []byte
+	pool     *x509.CertPool
+	onReload []func(*x509.CertPool)
+}
+
+var _ Reloadable = &CertPool{}
+
+// NewCertPool loads the named pool of CA certificates from the PEM file.
+func NewCertPool(name, path string) (*CertPool, error) {
+	certPool := &CertPool{name: name, path: path}
+	if _, err := certPool.Reload(); err != nil {
+		return nil, err
+	}
+	return certPool, nil
+}
+
+func (p *CertPool) Name() string {
+	return p.name
+}
+
+func (p *CertPool) Paths() []string {
+	return []string{p.path}
+}
+
+func (p *CertPool) Reload() (bool, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return false, fmt.Errorf("read CA certificates from file %q: %w", p.path, err)
+	}
+
+	p.lock.Lock()
+	if p.pool != nil && bytes.Equal(data, p.pem) {
+		p.lock.Unlock()
+		return false, nil
+	}
+	pool, err := ParseCertPool(p.name, data)
+	if err != nil {
+		p.lock.Unlock()
+		return false, fmt.Errorf("load CA certificates from file %q: %w", p.path, err)
+	}
+	p.pem, p.pool = data, pool
+	onReload := p.onReload
+	p.lock.Unlock()
+
+	for _, f := range onReload {
+		f(pool)
+	}
+	return true, nil
+}
+
+// Pool provides the current pool of CA certificates.
+func (p *CertPool) Pool() *x509.CertPool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.pool
+}
+
+// OnReload registers a function called with the new pool each time the CA certificates change. The pool of
+// a tls.Config cannot be swapped once it is in use, so its users build a new config from the new pool.
+func (p *CertPool) OnReload(f func(*x509.CertPool)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.onReload = append(p.onReload, f)
+}
+
+// ParseCertPool parses the named PEM encoded CA certificates, recording their earliest expiry.
+func ParseCertPool(name string, data []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	var notAfter time.Time
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(cert)
+		if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	if notAfter.IsZero() {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	ObserveExpiry(name, notAfter)
+	return pool, nil
+}
@@ -0,0 +1,108 @@
+package certwatch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+
+	"kong-portal-controller/internal/metrics"
+)
+
+// Watcher reloads the TLS material whose files change on disk. The directories holding the files are
+// watched rather than the files themselves, Secret volumes being updated by swapping a symbolic link.
+type Watcher struct {
+	logger logr.Logger
+
+	lock        sync.Mutex
+	reloadables []Reloadable
+}
+
+// NewWatcher provides a Watcher with nothing to watch yet.
+func NewWatcher(logger logr.Logger) *Watcher {
+	return &Watcher{logger: logger}
+}
+
+// Watch registers TLS material to reload, before the Watcher starts.
+func (w *Watcher) Watch(reloadable Reloadable) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.reloadables = append(w.reloadables, reloadable)
+}
+
+// NeedLeaderElection implements LeaderElectionRunnable, every replica using its own TLS material.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start watches the files of the registered TLS material until the context is done.
+func (w *Watcher) Start(ctx context.Context) error {
+	w.lock.Lock()
+	reloadables := append([]Reloadable(nil), w.reloadables...)
+	w.lock.Unlock()
+	if len(reloadables) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch TLS files: %w", err)
+	}
+	defer watcher.Close()
+
+	// the TLS material to reload on a change in each directory
+	dirs := make(map[string][]Reloadable)
+	for _, reloadable := range reloadables {
+		seen := make(map[string]bool)
+		for _, path := range reloadable.Paths() {
+			dir := filepath.Dir(path)
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			if _, ok := dirs[dir]; !ok {
+				if err := watcher.Add(dir); err != nil {
+					return fmt.Errorf("failed to watch TLS files in %q: %w", dir, err)
+				}
+			}
+			dirs[dir] = append(dirs[dir], reloadable)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			for _, reloadable := range dirs[filepath.Dir(event.Name)] {
+				w.reload(reloadable)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Error(err, "Failed to watch TLS files")
+		}
+	}
+}
+
+// reload reloads the TLS material, keeping the one in use when the files cannot be loaded, as they
+// may be in the middle of an update.
+func (w *Watcher) reload(reloadable Reloadable) {
+	changed, err := reloadable.Reload()
+	if err != nil {
+		w.logger.Error(err, "Failed to reload TLS files", "certificate", reloadable.Name(), "paths", reloadable.Paths())
+		promMetrics.CertificateReloadCount.WithLabelValues(reloadable.Name(), metrics.SuccessFalse).Inc()
+		return
+	}
+	if changed {
+		w.logger.Info("Reloaded TLS files", "certificate", reloadable.Name(), "paths", reloadable.Paths())
+		promMetrics.CertificateReloadCount.WithLabelValues(reloadable.Name(), metrics.SuccessTrue).Inc()
+	}
+}
@@ -0,0 +1,205 @@
+package certwatch
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// newKeyPairPEM provides a self-signed certificate of the common name and its private key, PEM encoded.
+func newKeyPairPEM(t *testing.T, commonName string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startWatcher watches the TLS material until the test ends.
+func startWatcher(t *testing.T, reloadables ...Reloadable) {
+	t.Helper()
+	watcher := NewWatcher(logr.Discard())
+	for _, reloadable := range reloadables {
+		watcher.Watch(reloadable)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- watcher.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Start() unexpected error: %v", err)
+		}
+	})
+	// the directories are watched shortly after the start
+	time.Sleep(100 * time.Millisecond)
+}
+
+func servedCommonName(t *testing.T, keyPair *KeyPair) string {
+	t.Helper()
+	certificate, err := keyPair.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() unexpected error: %v", err)
+	}
+	return certificate.Leaf.Subject.CommonName
+}
+
+// waitForCommonName waits for the key pair to serve the certificate of the common name.
+func waitForCommonName(t *testing.T, keyPair *KeyPair, commonName string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCommonName(t, keyPair) != commonName {
+		if time.Now().After(deadline) {
+			t.Fatalf("served certificate = %q, want %q to be reloaded", servedCommonName(t, keyPair), commonName)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatcherReloadsRewrittenFiles(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := newKeyPairPEM(t, "first")
+	writeFile(t, certPath, certPEM)
+	writeFile(t, keyPath, keyPEM)
+	keyPair, err := NewKeyPair("test", certPath, keyPath)
+	if err != nil {
+		t.Fatalf("NewKeyPair() unexpected error: %v", err)
+	}
+	startWatcher(t, keyPair)
+
+	certPEM, keyPEM = newKeyPairPEM(t, "second")
+	writeFile(t, certPath, certPEM)
+	writeFile(t, keyPath, keyPEM)
+	waitForCommonName(t, keyPair, "second")
+}
+
+func TestWatcherReloadsSwappedSymlinks(t *testing.T) {
+	// Secret volumes link the files to a data directory, whose link is swapped on an update
+	dir := t.TempDir()
+	writeVersion := func(version, commonName string) {
+		certPEM, keyPEM := newKeyPairPEM(t, commonName)
+		if err := os.Mkdir(filepath.Join(dir, version), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(dir, version, "tls.crt"), certPEM)
+		writeFile(t, filepath.Join(dir, version, "tls.key"), keyPEM)
+		if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeVersion("..v1", "first")
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if err := os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyPair, err := NewKeyPair("test", filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatalf("NewKeyPair() unexpected error: %v", err)
+	}
+	startWatcher(t, keyPair)
+
+	writeVersion("..v2", "second")
+	waitForCommonName(t, keyPair, "second")
+}
+
+func TestWatcherKeepsCertificateOnReloadFailure(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := newKeyPairPEM(t, "first")
+	writeFile(t, certPath, certPEM)
+	writeFile(t, keyPath, keyPEM)
+	keyPair, err := NewKeyPair("test", certPath, keyPath)
+	if err != nil {
+		t.Fatalf("NewKeyPair() unexpected error: %v", err)
+	}
+	startWatcher(t, keyPair)
+
+	// a certificate which does not match the key cannot be loaded
+	mismatching, _ := newKeyPairPEM(t, "mismatching")
+	writeFile(t, certPath, mismatching)
+	time.Sleep(200 * time.Millisecond)
+	if commonName := servedCommonName(t, keyPair); commonName != "first" {
+		t.Errorf("served certificate = %q after a failed reload, want the previous one", commonName)
+	}
+	if changed, err := keyPair.Reload(); err == nil || changed {
+		t.Errorf("Reload() = %t, %v, want an error", changed, err)
+	}
+
+	certPEM, keyPEM = newKeyPairPEM(t, "second")
+	writeFile(t, keyPath, keyPEM)
+	writeFile(t, certPath, certPEM)
+	waitForCommonName(t, keyPair, "second")
+}
+
+func TestWatcherReloadsCertPool(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ca.crt")
+	certPEM, _ := newKeyPairPEM(t, "first")
+	writeFile(t, path, certPEM)
+	certPool, err := NewCertPool("test", path)
+	if err != nil {
+		t.Fatalf("NewCertPool() unexpected error: %v", err)
+	}
+	reloaded := make(chan struct{}, 10)
+	certPool.OnReload(func(*x509.CertPool) {
+		reloaded <- struct{}{}
+	})
+	startWatcher(t, certPool)
+	previous := certPool.Pool()
+
+	certPEM, _ = newKeyPairPEM(t, "second")
+	writeFile(t, path, certPEM)
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("CA certificates not reloaded")
+	}
+	if certPool.Pool().Equal(previous) {
+		t.Errorf("Pool() provides the previous CA certificates once reloaded")
+	}
+}
@@ -0,0 +1,168 @@
+package rootcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"kong-portal-controller/internal/annotations"
+	"kong-portal-controller/internal/dataplane/proxy"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// manifestOptions are the flags of the manifest command.
+type manifestOptions struct {
+	namespace       string
+	objectName      string
+	controllerClass string
+	kind            string
+	path            string
+	title           string
+	layout          string
+	contentEncoding string
+}
+
+var manifestOpts manifestOptions
+
+func init() {
+	flags := manifestCmd.Flags()
+	flags.StringVar(&manifestOpts.namespace, "namespace", "", `Namespace of the KongFiles, left unset when empty.`)
+	flags.StringVar(&manifestOpts.objectName, "object-name", "", `Name of the KongFile, only with a single file. Defaults to the file name.`)
+	flags.StringVar(&manifestOpts.controllerClass, "controller-class", annotations.DefaultControllerClass, `Name of the controller class publishing the KongFiles.`)
+	flags.StringVar(&manifestOpts.kind, "kind", developer.SPECIFICATION, `Kind of the KongFiles. Allowed values are CONTENT, SPECIFICATION and ASSET.`)
+	flags.StringVar(&manifestOpts.path, "path", "", `Path of the files in the portal, relative to the directory of their kind.`)
+	flags.StringVar(&manifestOpts.title, "title", "", `Title of CONTENT files.`)
+	flags.StringVar(&manifestOpts.layout, "layout", "", `Layout of CONTENT files.`)
+	flags.StringVar(&manifestOpts.contentEncoding, "content-encoding", string(developer.ContentEncodingGzipBase64),
+		`Encoding of the content of the KongFiles. Allowed values are gzip+base64 and the empty string, which leaves the content as is.`)
+
+	rootCmd.AddCommand(manifestCmd)
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest FILE...",
+	Short: "Print KongFile manifests publishing local files",
+	Long: `Print the manifests of KongFiles publishing local files, one YAML document per file. The content is
+compressed by default, so that large files such as generated specifications fit in a KongFile.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeManifests(cmd.OutOrStdout(), manifestOpts, args)
+	},
+	SilenceUsage: true,
+}
+
+// writeManifests writes the manifests of the KongFiles publishing the files.
+func writeManifests(out io.Writer, opts manifestOptions, files []string) error {
+	if opts.objectName != "" && len(files) > 1 {
+		return fmt.Errorf("--object-name cannot be used with several files")
+	}
+	for i, file := range files {
+		kongFile, err := buildManifest(opts, file)
+		if err != nil {
+			return err
+		}
+		manifest, err := marshalManifest(kongFile)
+		if err != nil {
+			return fmt.Errorf("failed to write the manifest of %q: %w", file, err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(out, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := out.Write(manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildManifest provides the KongFile publishing the file, checking its spec as the controller would.
+func buildManifest(opts manifestOptions, file string) (*developer.KongFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(file)
+	objectName := opts.objectName
+	if objectName == "" {
+		objectName = objectNameFor(name)
+	}
+	kongFile := &developer.KongFile{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: developer.GroupVersion.String(),
+			Kind:       "KongFile",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        objectName,
+			Namespace:   opts.namespace,
+			Annotations: map[string]string{annotations.ControllerClassKey: opts.controllerClass},
+		},
+		Spec: developer.KongFileSpec{
+			Name:            name,
+			Path:            opts.path,
+			Kind:            developer.Kind(opts.kind),
+			Title:           opts.title,
+			Layout:          opts.layout,
+			ContentEncoding: developer.ContentEncoding(opts.contentEncoding),
+		},
+	}
+
+	switch {
+	case kongFile.Spec.ContentEncoding != "":
+		encoded, err := proxy.EncodeContent(kongFile.Spec.ContentEncoding, data)
+		if err != nil {
+			return nil, err
+		}
+		kongFile.Spec.Content = string(encoded)
+	case utf8.Valid(data):
+		kongFile.Spec.Content = string(data)
+	default:
+		kongFile.Spec.BinaryContent = data
+	}
+
+	if _, err := proxy.BuildPath(kongFile); err != nil {
+		return nil, fmt.Errorf("cannot publish %q: %w", file, err)
+	}
+	if err := proxy.ValidateContentSource(&kongFile.Spec); err != nil {
+		return nil, fmt.Errorf("cannot publish %q: %w", file, err)
+	}
+	return kongFile, nil
+}
+
+// invalidObjectNameChars are the characters which cannot be part of a resource name.
+var invalidObjectNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// objectNameFor provides a resource name derived from a file name.
+func objectNameFor(name string) string {
+	objectName := invalidObjectNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(objectName, "-.")
+}
+
+// marshalManifest provides the YAML manifest of the KongFile, without its status and the fields
+// the API server sets.
+func marshalManifest(kongFile *developer.KongFile) ([]byte, error) {
+	data, err := json.Marshal(kongFile)
+	if err != nil {
+		return nil, err
+	}
+	manifest := map[string]interface{}{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	delete(manifest, "status")
+	if metadata, ok := manifest["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return yaml.Marshal(manifest)
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 
+	"kong-portal-controller/internal/dataplane/configuration"
 	"kong-portal-controller/internal/manager"
 )
 
 func Run(ctx context.Context, c *manager.Config) error {
-	_, err := StartDiagnosticsServer(ctx, manager.DiagnosticsPort, c)
+	var configDumps chan *configuration.KongConfigUpdate
+	if c.EnableConfigDumps {
+		configDumps = make(chan *configuration.KongConfigUpdate, DiagnosticConfigBufferDepth)
+	}
+	_, err := StartDiagnosticsServer(ctx, manager.DiagnosticsPort, c, configDumps)
 	if err != nil {
 		return fmt.Errorf("failed to start diagnostics server: %w", err)
 	}
-	return manager.Run(ctx, c)
+	return manager.Run(ctx, c, configDumps)
 }
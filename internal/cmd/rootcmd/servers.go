@@ -6,6 +6,7 @@ import (
 
 	"github.com/bombsimon/logrusr/v2"
 
+	"kong-portal-controller/internal/dataplane/configuration"
 	"kong-portal-controller/internal/diagnostics"
 	"kong-portal-controller/internal/manager"
 	"kong-portal-controller/internal/util"
@@ -20,14 +21,14 @@ const (
 	DiagnosticConfigBufferDepth = 3
 )
 
-func StartDiagnosticsServer(ctx context.Context, port int, c *manager.Config) (diagnostics.Server, error) {
+func StartDiagnosticsServer(ctx context.Context, port int, c *manager.Config, configDumps <-chan *configuration.KongConfigUpdate) (diagnostics.Server, error) {
 	customizedLogger, err := util.MakeLogger(c.LogLevel, c.LogFormat)
 	if err != nil {
 		return diagnostics.Server{}, err
 	}
 	logger := logrusr.New(customizedLogger)
 
-	if !c.EnableProfiling {
+	if !c.EnableProfiling && !c.EnableConfigDumps {
 		logger.Info("Diagnostics server disabled")
 		return diagnostics.Server{}, nil
 	}
@@ -37,6 +38,9 @@ func StartDiagnosticsServer(ctx context.Context, port int, c *manager.Config) (d
 		ProfilingEnabled: c.EnableProfiling,
 		ConfigLock:       &sync.RWMutex{},
 	}
+	if c.EnableConfigDumps {
+		s.ConfigDumps = configDumps
+	}
 
 	go func() {
 		if err := s.Listen(ctx, port); err != nil {
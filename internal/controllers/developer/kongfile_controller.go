@@ -2,35 +2,58 @@ package developer
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrlutils "kong-portal-controller/internal/controllers/utils"
 	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
 	"kong-portal-controller/internal/util"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	developerv1 "kong-portal-controller/pkg/apis/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // KongFileReconciler reconciles a KongFile object
 type KongFileReconciler struct {
 	client.Client
 
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	Proxy  proxy.Proxy
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Proxy    proxy.Proxy
+	Recorder record.EventRecorder
+	// APIReader reads the ConfigMaps and Secrets KongFiles read their content from, which are not cached
+	APIReader client.Reader
 
 	ControllerClassName string
+	// ContentRoot is the directory the spec.contentFrom.file of KongFiles are read from
+	ContentRoot string
 }
 
+// ContentFileRequeueInterval is how often the KongFiles reading their content from a file read it again,
+// files not being watched.
+const ContentFileRequeueInterval = time.Minute
+
 //+kubebuilder:rbac:groups=developer.konghq.com,resources=kongFiles,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=developer.konghq.com,resources=kongFiles/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=developer.konghq.com,resources=kongFiles/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -62,63 +85,360 @@ func (r *KongFileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	// clean the object up if it's being deleted
-	if !obj.DeletionTimestamp.IsZero() && time.Now().After(obj.DeletionTimestamp.Time) {
+	if !obj.DeletionTimestamp.IsZero() {
 		log.V(util.InfoLevel).Info("Resource is being deleted, its configuration will be removed", "type", "KongFile", "namespace", req.Namespace, "name", req.Name)
-		objectExistsInCache, err := r.Proxy.ObjectExists(obj)
-		if err != nil {
+		return r.finalize(ctx, log, obj)
+	}
+
+	// if the object is configured with our controller.class, then we need to ensure it's removed from the cache
+	if !ctrlutils.MatchesControllerClassName(obj, r.ControllerClassName) {
+		log.V(util.InfoLevel).Info("Object missing controller class, ensuring it's removed from configuration", "namespace", req.Namespace, "name", req.Name)
+		if status, known := r.Proxy.ObjectStatus(obj); controllerutil.ContainsFinalizer(obj, developerv1.KongFileFinalizer) && (!known || !status.Deleting) {
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonSkipped,
+				"controller class doesn't match %q, the file is removed from Kong", r.ControllerClassName)
+		}
+		return r.finalize(ctx, log, obj)
+	}
+
+	// ensure the file is removed from Kong before the object is released
+	if !controllerutil.ContainsFinalizer(obj, developerv1.KongFileFinalizer) {
+		controllerutil.AddFinalizer(obj, developerv1.KongFileFinalizer)
+		if err := r.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// a KongFile publishing a file at the same path, or an older one, owns it: wait for the path to be released
+	original := obj.Status.DeepCopy()
+	path, err := proxy.BuildPath(obj)
+	var owner *developerv1.KongFile
+	if err == nil {
+		if owner, err = r.pathOwner(ctx, obj, path); err != nil {
 			return ctrl.Result{}, err
 		}
-		if objectExistsInCache {
-			if err := r.Proxy.DeleteObject(obj); err != nil {
+	}
+	if owner != nil {
+		message := fmt.Sprintf("file path %q is already published by KongFile %s/%s", path, owner.Namespace, owner.Name)
+		log.V(util.InfoLevel).Info("Object path conflicts with another object, it won't be published", "namespace", req.Namespace, "name", req.Name, "owner", client.ObjectKeyFromObject(owner).String())
+		setCondition(obj, developerv1.KongFileConditionConflict, metav1.ConditionTrue, developerv1.KongFileReasonPathConflict, message)
+		setCondition(obj, developerv1.KongFileConditionPublished, metav1.ConditionFalse, developerv1.KongFileReasonConflict, message)
+		if conditionChanged(original, &obj.Status, developerv1.KongFileConditionConflict) {
+			r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonConflict, message)
+		}
+		// a KongFile moving onto the path of another one removes its file from its previous path first
+		if previous := proxy.PublishedPath(r.Proxy, obj); previous != "" && previous != path {
+			if err := r.unpublishPrevious(obj, original, previous); err != nil {
 				return ctrl.Result{}, err
 			}
-			return ctrl.Result{Requeue: true}, nil // wait until the object is no longer present in the cache
+			return ctrl.Result{}, r.updateStatus(ctx, obj, original)
 		}
-		return ctrl.Result{}, nil
+		r.Proxy.ForgetObject(obj)
+		return ctrl.Result{}, r.updateStatus(ctx, obj, original)
+	}
+	if meta.FindStatusCondition(obj.Status.Conditions, developerv1.KongFileConditionConflict) != nil {
+		setCondition(obj, developerv1.KongFileConditionConflict, metav1.ConditionFalse, developerv1.KongFileReasonNoConflict, "")
 	}
 
-	// if the object is configured with our controller.class, then we need to ensure it's removed from the cache
-	if !ctrlutils.MatchesControllerClassName(obj, r.ControllerClassName) {
-		log.V(util.InfoLevel).Info("Object missing controller class, ensuring it's removed from configuration", "namespace", req.Namespace, "name", req.Name)
-		return ctrl.Result{}, nil
+	// refuse specs which cannot be translated into a Kong file
+	if message, ok := validateSpec(obj); !ok {
+		log.V(util.InfoLevel).Info("Object spec is invalid, it won't be published", "namespace", req.Namespace, "name", req.Name, "reason", message)
+		setCondition(obj, developerv1.KongFileConditionAccepted, metav1.ConditionFalse, developerv1.KongFileReasonInvalid, message)
+		return ctrl.Result{}, r.updateStatus(ctx, obj, original)
+	}
+	setCondition(obj, developerv1.KongFileConditionAccepted, metav1.ConditionTrue, developerv1.KongFileReasonAccepted, "")
+
+	// read the content selected by spec.contentFrom, the file already in Kong is kept until it resolves again.
+	// Content files are not watched, they are read again periodically
+	var result ctrl.Result
+	if obj.Spec.ContentFrom != nil && obj.Spec.ContentFrom.File != "" {
+		result.RequeueAfter = ContentFileRequeueInterval
+	}
+	resolved, err := proxy.ResolveContent(ctx, r.APIReader, r.ContentRoot, obj)
+	if refErr := asContentRefError(err); refErr != nil {
+		log.V(util.InfoLevel).Info("Object content cannot be resolved, it won't be published", "namespace", req.Namespace, "name", req.Name, "reason", refErr.Error())
+		setCondition(obj, developerv1.KongFileConditionResolvedRefs, metav1.ConditionFalse, reasonForContentRef(refErr), refErr.Error())
+		if conditionChanged(original, &obj.Status, developerv1.KongFileConditionResolvedRefs) {
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonRefNotResolved, "failed to resolve the content: %v", refErr)
+		}
+		return result, r.updateStatus(ctx, obj, original)
+	} else if encodingErr := asContentEncodingError(err); encodingErr != nil {
+		log.V(util.InfoLevel).Info("Object content cannot be decoded, it won't be published", "namespace", req.Namespace, "name", req.Name, "reason", encodingErr.Error())
+		setCondition(obj, developerv1.KongFileConditionAccepted, metav1.ConditionFalse, developerv1.KongFileReasonInvalid, encodingErr.Error())
+		return result, r.updateStatus(ctx, obj, original)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	contentChanged := false
+	if obj.Spec.ContentFrom != nil {
+		setCondition(obj, developerv1.KongFileConditionResolvedRefs, metav1.ConditionTrue, developerv1.KongFileReasonResolvedRefs, "")
+		contentChanged = obj.Status.ContentChecksum != proxy.ContentChecksum(&resolved.Spec)
+	} else {
+		meta.RemoveStatusCondition(&obj.Status.Conditions, developerv1.KongFileConditionResolvedRefs)
 	}
 
-	if obj.Status.Validated == false {
-		// update the kong Admin API with the changes
-		log.V(util.InfoLevel).Info("Object missing, ensuring it's created into configuration",
+	// every spec change bumps metadata.generation, submit each generation to the proxy once, as well as
+	// each change of the content read from spec.contentFrom, then report the outcome of the operation when
+	// the proxy notifies it has been applied
+	status, known := r.Proxy.ObjectStatus(obj)
+	if !known || status.Deleting || status.Generation != obj.Generation || contentChanged {
+		// queue the changes for the kong Admin API
+		log.V(util.InfoLevel).Info("Object changed, ensuring it's updated into configuration",
 			"namespace", req.Namespace,
 			"name", req.Name,
-			"status", obj.Status.Validated)
+			"generation", obj.Generation,
+			"observedGeneration", obj.Status.ObservedGeneration)
 
-		if err := r.Proxy.UpdateObject(obj); err != nil {
+		if err := r.Proxy.UpdateObject(resolved); err != nil {
 			log.Error(err, "Failed to update resource")
 			return ctrl.Result{}, err
 		}
-		// validated
-		obj.Status.Validated = true
+		obj.Status.ContentChecksum = ""
+		if obj.Spec.ContentFrom != nil {
+			obj.Status.ContentChecksum = proxy.ContentChecksum(&resolved.Spec)
+		}
+
+		// the status.observedGeneration only moves once a generation is published, objects unknown to the proxy
+		// after a restart keep the status of their published generation until the proxy checked them
+		if obj.Status.ObservedGeneration != obj.Generation || contentChanged {
+			setCondition(obj, developerv1.KongFileConditionPublished, metav1.ConditionUnknown, developerv1.KongFileReasonPending, "waiting for the file to be applied to Kong")
+		}
+		return ctrl.Result{}, r.updateStatus(ctx, obj, original)
+	}
+
+	// the proxy retries failed operations, only report them. Permanent failures are not retried
+	// until the next generation, so they are reported as terminal
+	if status.Err != nil {
+		if services.IsPermanent(status.Err) {
+			log.V(util.InfoLevel).Info("Object rejected by Kong, it won't be published until it changes", "namespace", req.Namespace, "name", req.Name, "error", status.Err.Error())
+			setCondition(obj, developerv1.KongFileConditionPublished, metav1.ConditionFalse, developerv1.KongFileReasonRejected, status.Err.Error())
+		} else {
+			log.V(util.InfoLevel).Info("Object failed to be published, the proxy will retry", "namespace", req.Namespace, "name", req.Name, "error", status.Err.Error())
+			setCondition(obj, developerv1.KongFileConditionPublished, metav1.ConditionFalse, developerv1.KongFileReasonPublishFailed, status.Err.Error())
+		}
+		setCondition(obj, developerv1.KongFileConditionDegraded, metav1.ConditionTrue, reasonForError(status.Err), status.Err.Error())
+		if conditionChanged(original, &obj.Status, developerv1.KongFileConditionPublished) {
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonPublishFailed, "failed to publish the file to Kong: %v", status.Err)
+		}
+		return result, r.updateStatus(ctx, obj, original)
+	}
+	if status.Pending {
+		return ctrl.Result{}, nil
+	}
+
+	// published
+	setFileStatus(obj, status)
+	setCondition(obj, developerv1.KongFileConditionPublished, metav1.ConditionTrue, developerv1.KongFileReasonPublished, "")
+	if status.Drifted {
+		setCondition(obj, developerv1.KongFileConditionDrifted, metav1.ConditionTrue, developerv1.KongFileReasonDrifted, "the file in Kong differs from the KongFile")
+	} else {
+		setCondition(obj, developerv1.KongFileConditionDrifted, metav1.ConditionFalse, developerv1.KongFileReasonInSync, "")
+	}
+	setCondition(obj, developerv1.KongFileConditionDegraded, metav1.ConditionFalse, developerv1.KongFileReasonAsExpected, "")
+	obj.Status.ObservedGeneration = obj.Generation
+
+	// report the publication of a new generation once
+	if previous := meta.FindStatusCondition(original.Conditions, developerv1.KongFileConditionPublished); previous == nil ||
+		previous.Status != metav1.ConditionTrue || previous.ObservedGeneration != obj.Generation {
+		if original.Path == "" {
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonPublished, "file published to Kong at %q", obj.Status.Path)
+		} else {
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonUpdated, "file updated in Kong at %q", obj.Status.Path)
+		}
+	}
 
-		log.V(util.InfoLevel).Info("Object validated, ensuring it's created into configuration",
+	if !equality.Semantic.DeepEqual(original, &obj.Status) {
+		log.V(util.InfoLevel).Info("Object published, updating its status",
 			"namespace", req.Namespace,
 			"name", req.Name,
-			"status", obj.Status)
+			"path", obj.Status.Path)
+	}
+	return result, r.updateStatus(ctx, obj, original)
+}
 
-		// update status
-		err := r.Status().Update(ctx, obj)
-		if err != nil {
-			log.Error(err, "Failed to update resource status")
-			return ctrl.Result{}, err
+// updateStatus updates the object status, unless it is unchanged from the original status.
+func (r *KongFileReconciler) updateStatus(ctx context.Context, obj *developerv1.KongFile, original *developerv1.KongFileStatus) error {
+	if equality.Semantic.DeepEqual(original, &obj.Status) {
+		return nil
+	}
+	if err := r.Status().Update(ctx, obj); err != nil {
+		r.Log.Error(err, "Failed to update resource status", "namespace", obj.Namespace, "name", obj.Name)
+		return err
+	}
+	return nil
+}
+
+// finalize removes the file from Kong using the path recorded at publish time, then releases the object
+// once the proxy applied the removal.
+func (r *KongFileReconciler) finalize(ctx context.Context, log logr.Logger, obj *developerv1.KongFile) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(obj, developerv1.KongFileFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	// a conflicting KongFile which removed its file from its previous path publishes nothing
+	conflicting := meta.IsStatusConditionTrue(obj.Status.Conditions, developerv1.KongFileConditionConflict) &&
+		proxy.PublishedPath(r.Proxy, obj) == ""
+	status, known := r.Proxy.ObjectStatus(obj)
+	switch {
+	case conflicting:
+		// the file belongs to the owner of the path, release the object
+	case known && status.Deleted:
+		// removed from Kong, release the object
+	case known && status.Deleting && status.Pending:
+		// the proxy retries failed removals, only report them
+		if status.Err != nil {
+			log.Error(status.Err, "Resource fail to be deleted, retrying ...", "type", "KongFile", "namespace", obj.Namespace, "name", obj.Name, "path", obj.Status.Path)
+			return ctrl.Result{}, r.reportDeleteFailure(ctx, obj, status.Err)
 		}
+		return ctrl.Result{}, nil
+	case known && status.Deleting && status.Err != nil && services.IsPermanent(status.Err):
+		// retrying would fail again, the finalizer has to be removed by hand once the file is handled
+		log.Error(status.Err, "Resource was refused to be deleted by Kong, it won't be retried", "type", "KongFile", "namespace", obj.Namespace, "name", obj.Name, "path", obj.Status.Path)
+		return ctrl.Result{}, r.reportDeleteFailure(ctx, obj, status.Err)
+	default:
+		return ctrl.Result{}, r.Proxy.DeleteObject(obj)
+	}
+
+	controllerutil.RemoveFinalizer(obj, developerv1.KongFileFinalizer)
+	if err := r.Update(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.Proxy.ForgetObject(obj)
+	if conflicting {
+		return ctrl.Result{}, nil
 	}
+	r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonDeleted, "file removed from Kong at %q", obj.Status.Path)
 
+	// the object is kept, make sure it gets published again if it is handed back to this controller
+	if obj.DeletionTimestamp.IsZero() {
+		setCondition(obj, developerv1.KongFileConditionPublished, metav1.ConditionFalse, developerv1.KongFileReasonUnpublished, "file removed from Kong")
+		clearFileStatus(obj)
+		return ctrl.Result{}, r.Status().Update(ctx, obj)
+	}
 	return ctrl.Result{}, nil
 }
 
+// unpublishPrevious removes the file of a conflicting KongFile from the path it previously published, once,
+// and then drops its state so that it waits for the owner to release its new path. Failures are reported
+// by the Degraded condition, the proxy retrying them unless they are permanent.
+func (r *KongFileReconciler) unpublishPrevious(obj *developerv1.KongFile, original *developerv1.KongFileStatus, previous string) error {
+	status, known := r.Proxy.ObjectStatus(obj)
+	switch {
+	case known && status.Deleted:
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonDeleted, "file removed from Kong at %q", previous)
+		if meta.IsStatusConditionTrue(obj.Status.Conditions, developerv1.KongFileConditionDegraded) {
+			setCondition(obj, developerv1.KongFileConditionDegraded, metav1.ConditionFalse, developerv1.KongFileReasonAsExpected, "")
+		}
+		clearFileStatus(obj)
+		r.Proxy.ForgetObject(obj)
+	case known && status.Deleting:
+		if status.Err != nil {
+			setCondition(obj, developerv1.KongFileConditionDegraded, metav1.ConditionTrue, developerv1.KongFileReasonDeleteFailed, status.Err.Error())
+			if conditionChanged(original, &obj.Status, developerv1.KongFileConditionDegraded) {
+				r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonDeleteFailed, "failed to remove the file from Kong: %v", status.Err)
+			}
+		}
+	default:
+		return r.Proxy.DeleteObject(obj)
+	}
+	return nil
+}
+
+// reportDeleteFailure sets the Degraded condition for a failed removal, and records an Event when it changed.
+func (r *KongFileReconciler) reportDeleteFailure(ctx context.Context, obj *developerv1.KongFile, err error) error {
+	original := obj.Status.DeepCopy()
+	setCondition(obj, developerv1.KongFileConditionDegraded, metav1.ConditionTrue, developerv1.KongFileReasonDeleteFailed, err.Error())
+	if conditionChanged(original, &obj.Status, developerv1.KongFileConditionDegraded) {
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonDeleteFailed, "failed to remove the file from Kong: %v", err)
+	}
+	return r.updateStatus(ctx, obj, original)
+}
+
+// pathOwner provides the KongFile of the controller class owning the provided path in Kong, when it takes
+// precedence over the object, see proxy.OwnsPathBefore. A KongFile still publishing the path, as recorded
+// in its status, owns it until its move or deletion is applied.
+func (r *KongFileReconciler) pathOwner(ctx context.Context, obj *developerv1.KongFile, path string) (*developerv1.KongFile, error) {
+	kongFiles := new(developerv1.KongFileList)
+	if err := r.List(ctx, kongFiles, client.MatchingFields{proxy.KongPathIndexKey: path}); err != nil {
+		return nil, err
+	}
+
+	var owner *developerv1.KongFile
+	for i := range kongFiles.Items {
+		candidate := &kongFiles.Items[i]
+		if candidate.Namespace == obj.Namespace && candidate.Name == obj.Name {
+			continue
+		}
+		if !ctrlutils.MatchesControllerClassName(candidate, r.ControllerClassName) || !proxy.OwnsPathBefore(candidate, obj, path) {
+			continue
+		}
+		if owner == nil || proxy.OwnsPathBefore(candidate, owner, path) {
+			owner = candidate
+		}
+	}
+	return owner, nil
+}
+
+// samePathRequests provides the KongFiles publishing a file at the same paths in Kong as the provided object,
+// the one of its spec and the one of its status, so that conflicts are resolved again whenever a KongFile
+// of the paths changes.
+func (r *KongFileReconciler) samePathRequests(obj client.Object) []reconcile.Request {
+	kongFile, ok := obj.(*developerv1.KongFile)
+	if !ok {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, path := range proxy.KongPathIndexer(kongFile) {
+		kongFiles := new(developerv1.KongFileList)
+		if err := r.List(context.Background(), kongFiles, client.MatchingFields{proxy.KongPathIndexKey: path}); err != nil {
+			r.Log.Error(err, "Failed to list KongFiles publishing the same path", "namespace", kongFile.Namespace, "name", kongFile.Name, "path", path)
+			return nil
+		}
+		for i := range kongFiles.Items {
+			if kongFiles.Items[i].Namespace == kongFile.Namespace && kongFiles.Items[i].Name == kongFile.Name {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&kongFiles.Items[i])})
+		}
+	}
+	return requests
+}
+
+// contentRefRequests provides a map function enqueuing the KongFiles which read their content from the
+// provided object of the kind, so that they are published again whenever it changes. Only the metadata
+// of the objects is watched.
+func (r *KongFileReconciler) contentRefRequests(kind string) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		return r.contentRefRequestsFor(obj, proxy.ContentRef(kind, obj.GetName()))
+	}
+}
+
+// contentRefRequestsFor provides the KongFiles of the namespace of the object indexed by the content reference.
+func (r *KongFileReconciler) contentRefRequestsFor(obj client.Object, ref string) []reconcile.Request {
+	kongFiles := new(developerv1.KongFileList)
+	if err := r.List(context.Background(), kongFiles, client.InNamespace(obj.GetNamespace()), client.MatchingFields{proxy.ContentRefIndexKey: ref}); err != nil {
+		r.Log.Error(err, "Failed to list KongFiles reading their content from "+ref, "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(kongFiles.Items))
+	for i := range kongFiles.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&kongFiles.Items[i])})
+	}
+	return requests
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *KongFileReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	preds := ctrlutils.GeneratePredicateFuncsForControllerClassFilter(r.ControllerClassName, false, true)
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&developerv1.KongFile{}, builder.WithPredicates(preds)).Complete(r)
+		For(&developerv1.KongFile{}, builder.WithPredicates(preds)).
+		Watches(&source.Kind{Type: &developerv1.KongFile{}}, handler.EnqueueRequestsFromMapFunc(r.samePathRequests)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.contentRefRequests("ConfigMap")), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.contentRefRequests("Secret")), builder.OnlyMetadata).
+		Watches(&source.Channel{Source: r.Proxy.StatusUpdates()}, &handler.EnqueueRequestForObject{}).
+		Complete(r)
 }
 
 // EnsureProxyDeleteObject is a reconciliation helper to ensure that an object is removed from
@@ -130,17 +450,19 @@ func EnsureProxyDeleteObject(proxy proxy.Proxy, obj client.Object) (ctrl.Result,
 		return ctrl.Result{}, false, err
 	}
 
-	// if the object is still present in the proxy cache, we need to keep trying to
-	// remove it until its gone so that it gets removed from backend data-plane.
+	// if the object is still present in the proxy cache, it needs to be removed from the
+	// backend data-plane. The cache is only updated once the removal was successful and the
+	// proxy notifies the object then, so there is no need to requeue.
 	if objectExistsInCache {
-		if err := proxy.DeleteObject(cached); err != nil {
-			return ctrl.Result{}, true, err
+		if status, known := proxy.ObjectStatus(cached); !known || !status.Deleting {
+			if err := proxy.DeleteObject(cached); err != nil {
+				return ctrl.Result{}, true, err
+			}
 		}
-		// the caller should requeue until the object is no longer present in the cache
-		// to ensure removal was successful
-		return ctrl.Result{Requeue: true}, true, nil
+		return ctrl.Result{}, true, nil
 	} else {
 		// if the object is not present in the proxy cache, we're all set
+		proxy.ForgetObject(obj)
 		return ctrl.Result{}, false, nil
 	}
 
@@ -0,0 +1,566 @@
+package developer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kong/go-kong/kong"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"kong-portal-controller/internal/annotations"
+	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
+	developerv1 "kong-portal-controller/pkg/apis/v1"
+)
+
+// fakeProxy is a proxy recording the operations submitted for the objects, which are applied
+// when the test calls apply.
+type fakeProxy struct {
+	proxy.Proxy
+
+	statuses map[string]proxy.FileStatus
+	cache    map[string]client.Object
+
+	updated   []string
+	deleted   []string
+	forgotten []string
+}
+
+func newFakeProxy() *fakeProxy {
+	return &fakeProxy{statuses: map[string]proxy.FileStatus{}, cache: map[string]client.Object{}}
+}
+
+func (p *fakeProxy) UpdateObject(obj client.Object) error {
+	key := client.ObjectKeyFromObject(obj).String()
+	p.updated = append(p.updated, key)
+	status := p.statuses[key]
+	status.Generation = obj.GetGeneration()
+	status.Pending, status.Deleting, status.Deleted = true, false, false
+	p.statuses[key] = status
+	return nil
+}
+
+func (p *fakeProxy) DeleteObject(obj client.Object) error {
+	key := client.ObjectKeyFromObject(obj).String()
+	p.deleted = append(p.deleted, key)
+	status := p.statuses[key]
+	status.Generation = obj.GetGeneration()
+	status.Pending, status.Deleting, status.Deleted = true, true, false
+	p.statuses[key] = status
+	return nil
+}
+
+func (p *fakeProxy) ObjectExistsInCache(obj client.Object) (client.Object, bool, error) {
+	cached, ok := p.cache[client.ObjectKeyFromObject(obj).String()]
+	return cached, ok, nil
+}
+
+func (p *fakeProxy) ObjectStatus(obj client.Object) (proxy.FileStatus, bool) {
+	status, ok := p.statuses[client.ObjectKeyFromObject(obj).String()]
+	return status, ok
+}
+
+func (p *fakeProxy) ForgetObject(obj client.Object) {
+	key := client.ObjectKeyFromObject(obj).String()
+	p.forgotten = append(p.forgotten, key)
+	delete(p.statuses, key)
+	delete(p.cache, key)
+}
+
+// apply completes the pending operation of the object as the proxy workers do, failing with the error unless it is nil,
+// in which case the operation stays pending unless the error is permanent. A file applied successfully is published
+// at the path.
+func (p *fakeProxy) apply(obj client.Object, path string, err error) {
+	key := client.ObjectKeyFromObject(obj).String()
+	status := p.statuses[key]
+	status.Pending = err != nil && !services.IsPermanent(err)
+	switch {
+	case err != nil:
+		status.Err = err
+	case status.Deleting:
+		status = proxy.FileStatus{Generation: status.Generation, Deleting: true, Deleted: true}
+		delete(p.cache, key)
+	default:
+		id, checksum, createdAt := "id-"+obj.GetName(), "checksum-"+obj.GetName(), 1650000000
+		status.Err = nil
+		status.File = &services.File{ID: &id, Checksum: &checksum, CreatedAt: &createdAt, Path: &path}
+		status.Workspace = "portal"
+		status.SyncedAt = time.Now()
+		p.cache[key] = obj.DeepCopyObject().(client.Object)
+	}
+	p.statuses[key] = status
+}
+
+// indexedClient lists KongFiles by the indexes of the manager cache, which the fake client ignores.
+type indexedClient struct {
+	client.Client
+}
+
+var testIndexers = map[string]client.IndexerFunc{
+	proxy.KongPathIndexKey:   proxy.KongPathIndexer,
+	proxy.ContentRefIndexKey: proxy.ContentRefIndexer,
+}
+
+func (c indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	fieldSelector := listOpts.FieldSelector
+	listOpts.FieldSelector = nil
+	if err := c.Client.List(ctx, list, listOpts); err != nil {
+		return err
+	}
+	kongFiles, ok := list.(*developerv1.KongFileList)
+	if !ok || fieldSelector == nil {
+		return nil
+	}
+	items := kongFiles.Items[:0]
+	for i := range kongFiles.Items {
+		if matchesIndexes(&kongFiles.Items[i], fieldSelector.Requirements()) {
+			items = append(items, kongFiles.Items[i])
+		}
+	}
+	kongFiles.Items = items
+	return nil
+}
+
+func matchesIndexes(obj client.Object, requirements fields.Requirements) bool {
+	for _, requirement := range requirements {
+		indexed := false
+		for _, value := range testIndexers[requirement.Field](obj) {
+			indexed = indexed || value == requirement.Value
+		}
+		if !indexed {
+			return false
+		}
+	}
+	return true
+}
+
+// testReconciler provides a reconciler of the provided KongFiles, publishing them through the proxy.
+func testReconciler(t *testing.T, p proxy.Proxy, objects ...client.Object) (*KongFileReconciler, *record.FakeRecorder) {
+	t.Helper()
+	testScheme := runtime.NewScheme()
+	if err := developerv1.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	kubeClient := indexedClient{fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).Build()}
+	recorder := record.NewFakeRecorder(100)
+	return &KongFileReconciler{
+		Client:              kubeClient,
+		Log:                 logr.Discard(),
+		Scheme:              testScheme,
+		Proxy:               p,
+		Recorder:            recorder,
+		APIReader:           kubeClient,
+		ControllerClassName: annotations.DefaultControllerClass,
+	}, recorder
+}
+
+// testKongFile provides a CONTENT KongFile of the default controller class, published at content/guides/<name>.md.
+func testKongFile(name string) *developerv1.KongFile {
+	return &developerv1.KongFile{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Generation:  1,
+			Annotations: map[string]string{annotations.ControllerClassKey: annotations.DefaultControllerClass},
+		},
+		Spec: developerv1.KongFileSpec{
+			Kind:    developerv1.CONTENT,
+			Path:    "guides",
+			Name:    name + ".md",
+			Title:   "Guide",
+			Layout:  "page",
+			Content: "# Guide",
+		},
+	}
+}
+
+// reconcileKongFile reconciles the KongFile and provides its updated version.
+func reconcileKongFile(t *testing.T, r *KongFileReconciler, obj client.Object) *developerv1.KongFile {
+	t.Helper()
+	key := client.ObjectKeyFromObject(obj)
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected error: %v", err)
+	}
+	updated := new(developerv1.KongFile)
+	if err := r.Get(context.Background(), key, updated); err != nil {
+		t.Fatalf("failed to get KongFile %s: %v", key, err)
+	}
+	return updated
+}
+
+// changeSpec changes the content of the KongFile, bumping its generation as the API server does.
+func changeSpec(t *testing.T, r *KongFileReconciler, obj *developerv1.KongFile, content string) *developerv1.KongFile {
+	t.Helper()
+	obj.Spec.Content = content
+	obj.Generation++
+	if err := r.Update(context.Background(), obj); err != nil {
+		t.Fatalf("failed to update KongFile: %v", err)
+	}
+	return obj
+}
+
+// events drains the events recorded so far.
+func events(recorder *record.FakeRecorder) []string {
+	var recorded []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			recorded = append(recorded, event)
+		default:
+			return recorded
+		}
+	}
+}
+
+func hasEvent(recorded []string, reason string) bool {
+	for _, event := range recorded {
+		if strings.Contains(event, " "+reason+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func assertCondition(t *testing.T, obj *developerv1.KongFile, conditionType string, status metav1.ConditionStatus, reason string) {
+	t.Helper()
+	condition := meta.FindStatusCondition(obj.Status.Conditions, conditionType)
+	if condition == nil {
+		t.Fatalf("condition %s is missing, want %s/%s", conditionType, status, reason)
+	}
+	if condition.Status != status || condition.Reason != reason {
+		t.Errorf("condition %s = %s/%s, want %s/%s", conditionType, condition.Status, condition.Reason, status, reason)
+	}
+	if condition.ObservedGeneration != obj.Generation {
+		t.Errorf("condition %s observedGeneration = %d, want %d", conditionType, condition.ObservedGeneration, obj.Generation)
+	}
+}
+
+func TestReconcileObservedGeneration(t *testing.T) {
+	p := newFakeProxy()
+	r, _ := testReconciler(t, p, testKongFile("guide"))
+
+	obj := reconcileKongFile(t, r, testKongFile("guide"))
+	if len(p.updated) != 1 {
+		t.Fatalf("UpdateObject() called %d times, want once", len(p.updated))
+	}
+	if obj.Status.ObservedGeneration != 0 {
+		t.Errorf("observedGeneration = %d before the file is published, want 0", obj.Status.ObservedGeneration)
+	}
+	assertCondition(t, obj, developerv1.KongFileConditionPublished, metav1.ConditionUnknown, developerv1.KongFileReasonPending)
+
+	p.apply(obj, "content/guides/guide.md", nil)
+	obj = reconcileKongFile(t, r, obj)
+	if obj.Status.ObservedGeneration != 1 {
+		t.Errorf("observedGeneration = %d once published, want 1", obj.Status.ObservedGeneration)
+	}
+
+	// a new generation is submitted once, and only observed once it is published
+	obj = changeSpec(t, r, obj, "# Updated guide")
+	obj = reconcileKongFile(t, r, obj)
+	obj = reconcileKongFile(t, r, obj)
+	if len(p.updated) != 2 {
+		t.Errorf("UpdateObject() called %d times, want once per generation", len(p.updated))
+	}
+	if obj.Status.ObservedGeneration != 1 {
+		t.Errorf("observedGeneration = %d while generation 2 is pending, want 1", obj.Status.ObservedGeneration)
+	}
+	assertCondition(t, obj, developerv1.KongFileConditionPublished, metav1.ConditionUnknown, developerv1.KongFileReasonPending)
+
+	// a failed generation is not observed
+	p.apply(obj, "content/guides/guide.md", services.Permanent(context.DeadlineExceeded))
+	obj = reconcileKongFile(t, r, obj)
+	if obj.Status.ObservedGeneration != 1 {
+		t.Errorf("observedGeneration = %d once generation 2 failed, want 1", obj.Status.ObservedGeneration)
+	}
+
+	obj = changeSpec(t, r, obj, "# Fixed guide")
+	obj = reconcileKongFile(t, r, obj)
+	p.apply(obj, "content/guides/guide.md", nil)
+	obj = reconcileKongFile(t, r, obj)
+	if obj.Status.ObservedGeneration != 3 {
+		t.Errorf("observedGeneration = %d once generation 3 is published, want 3", obj.Status.ObservedGeneration)
+	}
+}
+
+func TestReconcileAfterRestart(t *testing.T) {
+	published := testKongFile("guide")
+	published.Finalizers = []string{developerv1.KongFileFinalizer}
+	published.Status.ObservedGeneration = 1
+	published.Status.Path = "content/guides/guide.md"
+	r, _ := testReconciler(t, newFakeProxy(), published)
+	meta.SetStatusCondition(&published.Status.Conditions, metav1.Condition{
+		Type: developerv1.KongFileConditionPublished, Status: metav1.ConditionTrue, ObservedGeneration: 1, Reason: developerv1.KongFileReasonPublished,
+	})
+	if err := r.Status().Update(context.Background(), published); err != nil {
+		t.Fatal(err)
+	}
+
+	// a proxy which does not know the object yet checks it again, without changing its published status
+	obj := reconcileKongFile(t, r, published)
+	if obj.Status.ObservedGeneration != 1 {
+		t.Errorf("observedGeneration = %d after a restart, want 1", obj.Status.ObservedGeneration)
+	}
+	assertCondition(t, obj, developerv1.KongFileConditionPublished, metav1.ConditionTrue, developerv1.KongFileReasonPublished)
+}
+
+func TestReconcileConditions(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		err           error
+		wantPublished metav1.ConditionStatus
+		wantReason    string
+		wantDegraded  metav1.ConditionStatus
+		wantDegReason string
+		wantEvent     string
+	}{
+		{
+			name:          "published",
+			wantPublished: metav1.ConditionTrue,
+			wantReason:    developerv1.KongFileReasonPublished,
+			wantDegraded:  metav1.ConditionFalse,
+			wantDegReason: developerv1.KongFileReasonAsExpected,
+			wantEvent:     EventReasonPublished,
+		},
+		{
+			name:          "rejected by Kong",
+			err:           services.Permanent(kong.NewAPIError(http.StatusBadRequest, "schema violation")),
+			wantPublished: metav1.ConditionFalse,
+			wantReason:    developerv1.KongFileReasonRejected,
+			wantDegraded:  metav1.ConditionTrue,
+			wantDegReason: developerv1.KongFileReasonAdminAPIRejected,
+			wantEvent:     EventReasonPublishFailed,
+		},
+		{
+			name:          "Kong failure",
+			err:           kong.NewAPIError(http.StatusServiceUnavailable, "unavailable"),
+			wantPublished: metav1.ConditionFalse,
+			wantReason:    developerv1.KongFileReasonPublishFailed,
+			wantDegraded:  metav1.ConditionTrue,
+			wantDegReason: developerv1.KongFileReasonAdminAPIError,
+			wantEvent:     EventReasonPublishFailed,
+		},
+		{
+			name:          "Kong unreachable",
+			err:           errors.New("connection refused"),
+			wantPublished: metav1.ConditionFalse,
+			wantReason:    developerv1.KongFileReasonPublishFailed,
+			wantDegraded:  metav1.ConditionTrue,
+			wantDegReason: developerv1.KongFileReasonAdminAPIUnreachable,
+			wantEvent:     EventReasonPublishFailed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProxy()
+			r, recorder := testReconciler(t, p, testKongFile("guide"))
+
+			obj := reconcileKongFile(t, r, testKongFile("guide"))
+			p.apply(obj, "content/guides/guide.md", tt.err)
+			obj = reconcileKongFile(t, r, obj)
+
+			assertCondition(t, obj, developerv1.KongFileConditionAccepted, metav1.ConditionTrue, developerv1.KongFileReasonAccepted)
+			assertCondition(t, obj, developerv1.KongFileConditionPublished, tt.wantPublished, tt.wantReason)
+			assertCondition(t, obj, developerv1.KongFileConditionDegraded, tt.wantDegraded, tt.wantDegReason)
+			if tt.err == nil {
+				assertCondition(t, obj, developerv1.KongFileConditionDrifted, metav1.ConditionFalse, developerv1.KongFileReasonInSync)
+				if obj.Status.Path != "content/guides/guide.md" || obj.Status.ID != "id-guide" || obj.Status.Checksum != "checksum-guide" || obj.Status.Workspace != "portal" {
+					t.Errorf("status = %+v, want the file published in Kong", obj.Status)
+				}
+			}
+			if recorded := events(recorder); !hasEvent(recorded, tt.wantEvent) {
+				t.Errorf("events = %v, want a %s event", recorded, tt.wantEvent)
+			}
+
+			// the conditions are stable, without recording the event again
+			obj = reconcileKongFile(t, r, obj)
+			assertCondition(t, obj, developerv1.KongFileConditionPublished, tt.wantPublished, tt.wantReason)
+			if recorded := events(recorder); hasEvent(recorded, tt.wantEvent) {
+				t.Errorf("events = %v, want the %s event recorded once", recorded, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestReasonForError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "bad request", err: services.Permanent(kong.NewAPIError(http.StatusBadRequest, "")), want: developerv1.KongFileReasonAdminAPIRejected},
+		{name: "conflict", err: kong.NewAPIError(http.StatusConflict, ""), want: developerv1.KongFileReasonAdminAPIRejected},
+		{name: "unauthorized", err: kong.NewAPIError(http.StatusUnauthorized, ""), want: developerv1.KongFileReasonAdminAPIRejected},
+		{name: "internal error", err: kong.NewAPIError(http.StatusInternalServerError, ""), want: developerv1.KongFileReasonAdminAPIError},
+		{name: "unavailable", err: kong.NewAPIError(http.StatusServiceUnavailable, ""), want: developerv1.KongFileReasonAdminAPIError},
+		{name: "permanent failure", err: services.Permanent(errors.New("file too large")), want: developerv1.KongFileReasonAdminAPIRejected},
+		{name: "network failure", err: errors.New("connection refused"), want: developerv1.KongFileReasonAdminAPIUnreachable},
+		{name: "timeout", err: context.DeadlineExceeded, want: developerv1.KongFileReasonAdminAPIUnreachable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reasonForError(tt.err); got != tt.want {
+				t.Errorf("reasonForError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileFinalizer(t *testing.T) {
+	p := newFakeProxy()
+	r, recorder := testReconciler(t, p, testKongFile("guide"))
+	ctx := context.Background()
+
+	obj := reconcileKongFile(t, r, testKongFile("guide"))
+	if !controllerutil.ContainsFinalizer(obj, developerv1.KongFileFinalizer) {
+		t.Fatalf("finalizers = %v, want %s", obj.Finalizers, developerv1.KongFileFinalizer)
+	}
+	p.apply(obj, "content/guides/guide.md", nil)
+	obj = reconcileKongFile(t, r, obj)
+
+	// the object is kept until the file is removed from Kong
+	if err := r.Delete(ctx, obj); err != nil {
+		t.Fatal(err)
+	}
+	obj = reconcileKongFile(t, r, obj)
+	if len(p.deleted) != 1 {
+		t.Fatalf("DeleteObject() called %d times, want once", len(p.deleted))
+	}
+	obj = reconcileKongFile(t, r, obj)
+	if len(p.deleted) != 1 {
+		t.Errorf("DeleteObject() called %d times while the removal is pending, want once", len(p.deleted))
+	}
+
+	// a failed removal is reported, the proxy retrying it
+	p.apply(obj, "", kong.NewAPIError(http.StatusServiceUnavailable, "unavailable"))
+	obj = reconcileKongFile(t, r, obj)
+	assertCondition(t, obj, developerv1.KongFileConditionDegraded, metav1.ConditionTrue, developerv1.KongFileReasonDeleteFailed)
+	if !controllerutil.ContainsFinalizer(obj, developerv1.KongFileFinalizer) {
+		t.Errorf("finalizer removed before the file is removed from Kong")
+	}
+
+	// the object is released once the file is removed
+	p.apply(obj, "", nil)
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)}); err != nil {
+		t.Fatalf("Reconcile() unexpected error: %v", err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); !apierrors.IsNotFound(err) {
+		t.Errorf("Get() error = %v once the file is removed, want the object released", err)
+	}
+	if len(p.forgotten) != 1 {
+		t.Errorf("ForgetObject() called %d times, want once", len(p.forgotten))
+	}
+	if recorded := events(recorder); !hasEvent(recorded, EventReasonDeleted) {
+		t.Errorf("events = %v, want a %s event", recorded, EventReasonDeleted)
+	}
+}
+
+func TestReconcileControllerClassChange(t *testing.T) {
+	p := newFakeProxy()
+	r, _ := testReconciler(t, p, testKongFile("guide"))
+
+	obj := reconcileKongFile(t, r, testKongFile("guide"))
+	p.apply(obj, "content/guides/guide.md", nil)
+	obj = reconcileKongFile(t, r, obj)
+
+	// a KongFile handed to another controller is unpublished and released, but kept
+	obj.Annotations[annotations.ControllerClassKey] = "other"
+	if err := r.Update(context.Background(), obj); err != nil {
+		t.Fatal(err)
+	}
+	obj = reconcileKongFile(t, r, obj)
+	p.apply(obj, "", nil)
+	obj = reconcileKongFile(t, r, obj)
+
+	if controllerutil.ContainsFinalizer(obj, developerv1.KongFileFinalizer) {
+		t.Errorf("finalizers = %v, want the finalizer removed", obj.Finalizers)
+	}
+	if obj.Status.Path != "" {
+		t.Errorf("status.path = %q, want the path released", obj.Status.Path)
+	}
+	assertCondition(t, obj, developerv1.KongFileConditionPublished, metav1.ConditionFalse, developerv1.KongFileReasonUnpublished)
+}
+
+func TestReconcileMoveOntoPublishedPath(t *testing.T) {
+	p := newFakeProxy()
+	r, recorder := testReconciler(t, p, testKongFile("shared"), testKongFile("guide"))
+	ctx := context.Background()
+
+	owner := reconcileKongFile(t, r, testKongFile("shared"))
+	p.apply(owner, "content/guides/shared.md", nil)
+	owner = reconcileKongFile(t, r, owner)
+	obj := reconcileKongFile(t, r, testKongFile("guide"))
+	p.apply(obj, "content/guides/guide.md", nil)
+	obj = reconcileKongFile(t, r, obj)
+
+	// a KongFile moving onto the path of another one removes its file from its previous path, once
+	obj.Spec.Name = "shared.md"
+	obj.Generation++
+	if err := r.Update(ctx, obj); err != nil {
+		t.Fatal(err)
+	}
+	obj = reconcileKongFile(t, r, obj)
+	obj = reconcileKongFile(t, r, obj)
+	if want := []string{"default/guide"}; !equal(p.deleted, want) {
+		t.Fatalf("DeleteObject() called for %v, want %v", p.deleted, want)
+	}
+	assertCondition(t, obj, developerv1.KongFileConditionConflict, metav1.ConditionTrue, developerv1.KongFileReasonPathConflict)
+	if obj.Status.Path != "content/guides/guide.md" {
+		t.Errorf("status.path = %q while the previous file is being removed, want content/guides/guide.md", obj.Status.Path)
+	}
+
+	p.apply(obj, "", nil)
+	obj = reconcileKongFile(t, r, obj)
+	if obj.Status.Path != "" {
+		t.Errorf("status.path = %q once the previous file is removed, want none", obj.Status.Path)
+	}
+	assertCondition(t, obj, developerv1.KongFileConditionPublished, metav1.ConditionFalse, developerv1.KongFileReasonConflict)
+	if recorded := events(recorder); !hasEvent(recorded, EventReasonDeleted) || !hasEvent(recorded, EventReasonConflict) {
+		t.Errorf("events = %v, want %s and %s events", recorded, EventReasonConflict, EventReasonDeleted)
+	}
+	if len(p.updated) != 2 {
+		t.Errorf("UpdateObject() called %d times, want the conflicting KongFile not published", len(p.updated))
+	}
+
+	// the path is published once its owner releases it
+	if err := r.Delete(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+	owner = reconcileKongFile(t, r, owner)
+	p.apply(owner, "", nil)
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(owner)}); err != nil {
+		t.Fatalf("Reconcile() unexpected error: %v", err)
+	}
+	obj = reconcileKongFile(t, r, obj)
+	p.apply(obj, "content/guides/shared.md", nil)
+	obj = reconcileKongFile(t, r, obj)
+	assertCondition(t, obj, developerv1.KongFileConditionConflict, metav1.ConditionFalse, developerv1.KongFileReasonNoConflict)
+	assertCondition(t, obj, developerv1.KongFileConditionPublished, metav1.ConditionTrue, developerv1.KongFileReasonPublished)
+	if obj.Status.Path != "content/guides/shared.md" {
+		t.Errorf("status.path = %q, want content/guides/shared.md", obj.Status.Path)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package developer
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kong/go-kong/kong"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
+	developerv1 "kong-portal-controller/pkg/apis/v1"
+)
+
+// Event reasons recorded on KongFiles
+const (
+	EventReasonPublished      = "Published"
+	EventReasonUpdated        = "Updated"
+	EventReasonDeleted        = "Deleted"
+	EventReasonPublishFailed  = "PublishFailed"
+	EventReasonDeleteFailed   = "DeleteFailed"
+	EventReasonSkipped        = "Skipped"
+	EventReasonConflict       = "Conflict"
+	EventReasonRefNotResolved = "RefNotResolved"
+)
+
+// setCondition sets a condition on the KongFile status for its current generation.
+func setCondition(obj *developerv1.KongFile, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: obj.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// conditionChanged indicates whether the condition of the provided type differs between two statuses.
+func conditionChanged(original, status *developerv1.KongFileStatus, conditionType string) bool {
+	previous := meta.FindStatusCondition(original.Conditions, conditionType)
+	current := meta.FindStatusCondition(status.Conditions, conditionType)
+	if previous == nil || current == nil {
+		return previous != current
+	}
+	return previous.Status != current.Status || previous.Reason != current.Reason || previous.Message != current.Message
+}
+
+// setFileStatus copies the state of the file in Kong into the KongFile status.
+func setFileStatus(obj *developerv1.KongFile, status proxy.FileStatus) {
+	if file := status.File; file != nil {
+		obj.Status.ID = stringValue(file.ID)
+		obj.Status.Checksum = stringValue(file.Checksum)
+		obj.Status.Path = stringValue(file.Path)
+		if file.CreatedAt != nil {
+			obj.Status.CreatedAt = int64(*file.CreatedAt)
+		}
+	}
+	obj.Status.Workspace = status.Workspace
+	// the API server stores times with a second precision
+	syncedAt := metav1.NewTime(status.SyncedAt.Truncate(time.Second))
+	obj.Status.LastSyncedTime = &syncedAt
+}
+
+// clearFileStatus drops the state of the file in Kong from the KongFile status once the file is removed,
+// so that the KongFile no longer owns its path.
+func clearFileStatus(obj *developerv1.KongFile) {
+	obj.Status.ID = ""
+	obj.Status.Checksum = ""
+	obj.Status.Path = ""
+	obj.Status.CreatedAt = 0
+}
+
+// validateSpec checks that the KongFile spec can be translated into a Kong file.
+func validateSpec(obj *developerv1.KongFile) (string, bool) {
+	if _, err := proxy.BuildPath(obj); err != nil {
+		return err.Error(), false
+	}
+	if err := proxy.ValidateContentSource(&obj.Spec); err != nil {
+		return err.Error(), false
+	}
+	return "", true
+}
+
+// asContentRefError provides the error reporting a spec.contentFrom which cannot be resolved, if it is one.
+func asContentRefError(err error) *proxy.ContentRefError {
+	var refErr *proxy.ContentRefError
+	if errors.As(err, &refErr) {
+		return refErr
+	}
+	return nil
+}
+
+// asContentEncodingError provides the error reporting a content which cannot be decoded, if it is one.
+func asContentEncodingError(err error) *proxy.ContentEncodingError {
+	var encodingErr *proxy.ContentEncodingError
+	if errors.As(err, &encodingErr) {
+		return encodingErr
+	}
+	return nil
+}
+
+// reasonForContentRef classifies a spec.contentFrom which cannot be resolved into a condition reason.
+func reasonForContentRef(refErr *proxy.ContentRefError) string {
+	if refErr.NotFound {
+		return developerv1.KongFileReasonRefNotFound
+	}
+	return developerv1.KongFileReasonInvalidRef
+}
+
+// reasonForError classifies an Admin API error into a condition reason.
+func reasonForError(err error) string {
+	var apiErr *kong.APIError
+	if !errors.As(err, &apiErr) {
+		if services.IsPermanent(err) {
+			return developerv1.KongFileReasonAdminAPIRejected
+		}
+		return developerv1.KongFileReasonAdminAPIUnreachable
+	}
+	if apiErr.Code() >= http.StatusInternalServerError {
+		return developerv1.KongFileReasonAdminAPIError
+	}
+	return developerv1.KongFileReasonAdminAPIRejected
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -2,18 +2,51 @@ package configuration
 
 import (
 	"context"
-	"github.com/go-logr/logr"
-	"kong-portal-controller/internal/metrics"
-	"kong-portal-controller/internal/store"
 	"time"
 
 	"github.com/blang/semver/v4"
 	"github.com/kong/go-kong/kong"
+
+	services "kong-portal-controller/internal/kong"
 )
 
 // KongConfigUpdate is a Kong developer and the time it was generated
 type KongConfigUpdate struct {
 	Timestamp time.Time
+
+	// Snapshot provides the current files of the proxy, they are only built when a dump is requested.
+	Snapshot func() *ConfigSnapshot `json:"-"`
+
+	// Live fetches the files currently in Kong, so that diffs can be computed on demand.
+	Live func(ctx context.Context) ([]*services.File, error) `json:"-"`
+}
+
+// ConfigSnapshot holds the files of the proxy at the time a dump is requested.
+type ConfigSnapshot struct {
+	// Desired holds every file rendered from the objects, without contents as they may be read from Secrets.
+	Desired []FileDump
+
+	// Applied holds the files last successfully written to Kong, without contents.
+	Applied []FileDump
+
+	// Failed holds the last error of the objects whose last operation failed.
+	Failed []FailureDump
+}
+
+// FileDump is a file of an object, as found in a ConfigSnapshot.
+type FileDump struct {
+	Object   string `json:"object"`
+	Kind     string `json:"kind"`
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"`
+}
+
+// FailureDump is the last error of an object, as found in a ConfigSnapshot.
+type FailureDump struct {
+	Object    string `json:"object"`
+	Delete    bool   `json:"delete"`
+	Error     string `json:"error"`
+	Permanent bool   `json:"permanent"`
 }
 
 // Kong Represents a Kong client and connection information
@@ -30,20 +63,3 @@ type Kong struct {
 
 	ConfigDone chan *KongConfigUpdate
 }
-
-// UpdateKongAdmin is a helper function for the most common usage of PerformUpdate() with only minimal
-// upfront configuration required. This function is specialized and highly opinionated.
-func UpdateKongAdmin(ctx context.Context,
-	store *store.CacheStores,
-	controllerClassName string,
-	logger logr.Logger,
-	kongConfig Kong,
-	enableReverseSync bool,
-	proxyRequestTimeout time.Duration,
-	promMetrics *metrics.CtrlFuncMetrics,
-) error {
-
-	logger.Info("Watch status of queue ....")
-
-	return nil
-}
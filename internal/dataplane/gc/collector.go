@@ -0,0 +1,153 @@
+// Package gc provides the garbage collection of Kong portal files which are no longer backed by a KongFile.
+package gc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/metrics"
+	"kong-portal-controller/internal/util"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// -----------------------------------------------------------------------------
+// Garbage Collector - Public Functions
+// -----------------------------------------------------------------------------
+
+// NewCollector provides a new Collector which deletes, every interval, the Kong files whose path starts
+// with one of the provided prefixes and which are neither backed by any KongFile nor known by the proxy.
+// In dry run mode the orphaned files are only reported.
+func NewCollector(logger logr.Logger,
+	kubeClient client.Client,
+	proxy proxy.Proxy,
+	service services.AbstractFileService,
+	prefixes []string,
+	interval time.Duration,
+	dryRun bool,
+) *Collector {
+	return &Collector{
+		kubeClient:  kubeClient,
+		proxy:       proxy,
+		service:     service,
+		prefixes:    prefixes,
+		interval:    interval,
+		dryRun:      dryRun,
+		logger:      logger,
+		promMetrics: metrics.NewGCMetrics(),
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Garbage Collector - Public Types
+// -----------------------------------------------------------------------------
+
+// Collector is a controller-runtime Runnable garbage collecting orphaned Kong files.
+type Collector struct {
+	kubeClient client.Client
+	proxy      proxy.Proxy
+	service    services.AbstractFileService
+
+	// the Kong files owned by the controller are the ones whose path starts with one of these prefixes
+	prefixes []string
+	interval time.Duration
+	dryRun   bool
+
+	promMetrics *metrics.GCMetrics
+
+	logger logr.Logger
+}
+
+// -----------------------------------------------------------------------------
+// Garbage Collector - Public Methods - Interface Implementation
+// -----------------------------------------------------------------------------
+
+// Start runs the garbage collection every interval until the context is done.
+func (c *Collector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.Collect(ctx); err != nil {
+				c.logger.Error(err, "Garbage collection of Kong files failed")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection makes sure a single replica deletes files.
+func (c *Collector) NeedLeaderElection() bool {
+	return true
+}
+
+// Collect deletes (or reports in dry run mode) the owned Kong files not backed by any KongFile.
+func (c *Collector) Collect(ctx context.Context) error {
+	// the files are listed before the KongFiles, so that a file published meanwhile is backed by its KongFile
+	files, err := c.service.ListAll(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	// every path published for a KongFile, whatever its controller class, is backed, as well as the
+	// paths the proxy applied or is about to apply for KongFiles the cache may not hold yet
+	kongFiles := new(developer.KongFileList)
+	if err := c.kubeClient.List(ctx, kongFiles); err != nil {
+		return err
+	}
+	backed := c.proxy.KnownPaths()
+	for i := range kongFiles.Items {
+		if path, err := proxy.BuildPath(&kongFiles.Items[i]); err == nil {
+			backed[path] = struct{}{}
+		}
+		if path := kongFiles.Items[i].Status.Path; path != "" {
+			backed[path] = struct{}{}
+		}
+	}
+
+	for _, file := range files {
+		if file.Path == nil || !c.owns(*file.Path) {
+			continue
+		}
+		if _, ok := backed[*file.Path]; ok {
+			continue
+		}
+
+		if c.dryRun {
+			c.logger.Info("Orphaned Kong file found, dry run enabled so it is kept", "path", *file.Path)
+		} else {
+			c.logger.Info("Orphaned Kong file found, deleting it", "path", *file.Path)
+			if err := c.service.Delete(ctx, file); err != nil && !services.IsNotFound(err) {
+				c.logger.Error(err, "Failed to delete orphaned Kong file", "path", *file.Path)
+				continue
+			}
+		}
+		c.promMetrics.FilesCollectedCount.WithLabelValues(strconv.FormatBool(c.dryRun)).Inc()
+	}
+
+	c.logger.V(util.DebugLevel).Info("Garbage collection of Kong files done", "files", len(files), "backed", len(backed))
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// Garbage Collector - Private Methods
+// -----------------------------------------------------------------------------
+
+// owns indicates whether the provided Kong path is managed by the controller.
+func (c *Collector) owns(path string) bool {
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
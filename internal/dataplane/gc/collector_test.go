@@ -0,0 +1,126 @@
+package gc
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/metrics"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// testMetrics are shared by the collectors of the tests, so that the metrics are registered once.
+var testMetrics = metrics.NewGCMetrics()
+
+// knownPathsProxy is a proxy knowing the files at the provided paths.
+type knownPathsProxy struct {
+	proxy.Proxy
+	paths map[string]struct{}
+}
+
+func (p knownPathsProxy) KnownPaths() map[string]struct{} {
+	return p.paths
+}
+
+// listedFileService lists the files at the provided paths, running onList before returning them,
+// and records the deleted ones.
+type listedFileService struct {
+	services.AbstractFileService
+	paths   []string
+	onList  func()
+	deleted []string
+}
+
+func (s *listedFileService) ListAll(_ context.Context, prefix string) ([]*services.File, error) {
+	files := make([]*services.File, 0, len(s.paths))
+	for i := range s.paths {
+		files = append(files, &services.File{Path: &s.paths[i]})
+	}
+	if s.onList != nil {
+		s.onList()
+	}
+	return files, nil
+}
+
+func (s *listedFileService) Delete(_ context.Context, file *services.File) error {
+	s.deleted = append(s.deleted, *file.Path)
+	return nil
+}
+
+func kongFile(name, path string) *developer.KongFile {
+	obj := &developer.KongFile{Spec: developer.KongFileSpec{Kind: developer.CONTENT, Path: path, Name: name}}
+	obj.Namespace = "default"
+	obj.Name = name
+	return obj
+}
+
+func TestCollect(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	if err := developer.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	moved := kongFile("moved.md", "new")
+	moved.Status.Path = "content/old/moved.md"
+	kubeClient := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(kongFile("backed.md", "guides"), moved).Build()
+
+	service := &listedFileService{
+		paths: []string{
+			"content/guides/backed.md",
+			"content/old/moved.md",
+			"content/guides/applied.md",
+			"content/guides/created.md",
+			"content/guides/orphan.md",
+			"themes/base/layouts/index.html",
+		},
+		// a KongFile created and published while the files are listed is backed
+		onList: func() {
+			if err := kubeClient.Create(context.Background(), kongFile("created.md", "guides")); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	collector := &Collector{
+		kubeClient: kubeClient,
+		// a KongFile applied by the proxy may not be in the cache yet
+		proxy:       knownPathsProxy{paths: map[string]struct{}{"content/guides/applied.md": {}}},
+		service:     service,
+		prefixes:    []string{"content/"},
+		logger:      logr.Discard(),
+		promMetrics: testMetrics,
+	}
+
+	if err := collector.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect() unexpected error: %v", err)
+	}
+	sort.Strings(service.deleted)
+	if want := []string{"content/guides/orphan.md"}; !equal(service.deleted, want) {
+		t.Errorf("Collect() deleted %v, want %v", service.deleted, want)
+	}
+
+	collector.dryRun = true
+	service.deleted, service.onList = nil, nil
+	if err := collector.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect() unexpected error: %v", err)
+	}
+	if len(service.deleted) > 0 {
+		t.Errorf("Collect() deleted %v in dry run mode, want none", service.deleted)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -6,16 +6,21 @@ import (
 	services "kong-portal-controller/internal/kong"
 	"kong-portal-controller/internal/store"
 	developer "kong-portal-controller/pkg/apis/v1"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/blang/semver/v4"
 	"github.com/go-logr/logr"
 	"github.com/kong/go-kong/kong"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	"kong-portal-controller/internal/dataplane/configuration"
 	"kong-portal-controller/internal/metrics"
+	"kong-portal-controller/internal/util"
 )
 
 // -----------------------------------------------------------------------------
@@ -29,15 +34,21 @@ func NewCacheBasedProxyWithStagger(logger logr.Logger,
 	kongConfig configuration.Kong,
 	controllerClassName string,
 	enableReverseSync bool,
+	resyncPeriod time.Duration,
+	driftPolicy DriftPolicy,
 	proxyRequestTimeout time.Duration,
+	stagger time.Duration,
+	sizeLimits SizeLimits,
 	store store.CacheStores,
-	service services.FileService,
+	service services.AbstractFileService,
 	context context.Context,
 ) (Proxy, error) {
 	proxy := &CachedProxyResolver{
 
 		kongConfig:        kongConfig,
 		enableReverseSync: enableReverseSync,
+		resyncPeriod:      resyncPeriod,
+		driftPolicy:       driftPolicy,
 
 		store:   store,
 		service: service,
@@ -48,8 +59,15 @@ func NewCacheBasedProxyWithStagger(logger logr.Logger,
 		controllerClassName: controllerClassName,
 
 		proxyRequestTimeout: proxyRequestTimeout,
+		stagger:             stagger,
+		sizeLimits:          sizeLimits,
 
 		configApplied: false,
+
+		statuses:      make(map[string]FileStatus),
+		pending:       make(map[string]operation),
+		queue:         workqueue.NewNamedRateLimitingQueue(jitteredRateLimiter{workqueue.DefaultControllerRateLimiter()}, "kong-files"),
+		statusUpdates: make(chan event.GenericEvent, statusUpdatesBufferDepth),
 	}
 
 	// initialize the proxy
@@ -60,6 +78,9 @@ func NewCacheBasedProxyWithStagger(logger logr.Logger,
 	return proxy, nil
 }
 
+// statusUpdatesBufferDepth is the size of the channel buffer notifying controllers of status changes.
+const statusUpdatesBufferDepth = 1024
+
 // -----------------------------------------------------------------------------
 // Client Go Cached Proxy Resolver - Private Types
 // -----------------------------------------------------------------------------
@@ -78,6 +99,8 @@ type CachedProxyResolver struct {
 	// kong developer
 	kongConfig        configuration.Kong
 	enableReverseSync bool
+	resyncPeriod      time.Duration
+	driftPolicy       DriftPolicy
 	dbmode            string
 	version           semver.Version
 
@@ -87,13 +110,25 @@ type CachedProxyResolver struct {
 	// kong store
 	store store.CacheStores
 	// kong service
-	service services.FileService
+	service services.AbstractFileService
+
+	// statuses of the objects as last applied to the Kong Admin API, and the latest
+	// operations waiting to be applied (both guarded by statusesLock)
+	statuses     map[string]FileStatus
+	pending      map[string]operation
+	statusesLock sync.RWMutex
+	// objects waiting for their pending operation to be applied
+	queue workqueue.RateLimitingInterface
+	// objects whose status changed outside of a reconciliation
+	statusUpdates chan event.GenericEvent
 
 	promMetrics *metrics.CtrlFuncMetrics
 
 	// server developer, flow control, channels and utility attributes
 	controllerClassName string
 	proxyRequestTimeout time.Duration
+	stagger             time.Duration
+	sizeLimits          SizeLimits
 
 	logger logr.Logger
 }
@@ -109,9 +144,8 @@ func (p *CachedProxyResolver) UpdateObject(obj client.Object) error {
 	// Kong API Support
 	// ----------------------------------------------------------------------------
 	case *developer.KongFile:
-		p.store.Update(obj)
-		_, err := p.service.Update(p.ctx, Build(obj))
-		return err
+		p.submit(operation{object: obj.DeepCopy()})
+		return nil
 	default:
 		return fmt.Errorf("cannot add unsupported kind %q to the store", obj.GetObjectKind().GroupVersionKind())
 	}
@@ -123,9 +157,8 @@ func (p *CachedProxyResolver) DeleteObject(obj client.Object) error {
 	// Kong API Support
 	// ----------------------------------------------------------------------------
 	case *developer.KongFile:
-		p.store.Delete(obj)
-		_, err := p.service.Delete(p.ctx, Build(obj))
-		return err
+		p.submit(operation{object: obj.DeepCopy(), delete: true})
+		return nil
 	default:
 		return fmt.Errorf("cannot add unsupported kind %q to the store", obj.GetObjectKind().GroupVersionKind())
 	}
@@ -137,15 +170,17 @@ func (p *CachedProxyResolver) ObjectExists(obj client.Object) (bool, error) {
 	// Kong API Support
 	// ----------------------------------------------------------------------------
 	case *developer.KongFile:
-		file, err := p.service.Get(p.ctx, Build(obj))
+		file, err := Build(obj)
 		if err != nil {
 			return false, err
 		}
-		if file != nil {
-			return true, nil
-		} else {
-			return false, nil
+		if _, err := p.service.Get(p.ctx, file); err != nil {
+			if services.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
 		}
+		return true, nil
 	default:
 		return false, fmt.Errorf("cannot add unsupported kind %q to the store", obj.GetObjectKind().GroupVersionKind())
 	}
@@ -160,6 +195,55 @@ func (p *CachedProxyResolver) ObjectExistsInCache(obj client.Object) (client.Obj
 	}
 }
 
+func (p *CachedProxyResolver) ObjectStatus(obj client.Object) (FileStatus, bool) {
+	p.statusesLock.RLock()
+	defer p.statusesLock.RUnlock()
+	status, ok := p.statuses[client.ObjectKeyFromObject(obj).String()]
+	return status, ok
+}
+
+func (p *CachedProxyResolver) ForgetObject(obj client.Object) {
+	key := client.ObjectKeyFromObject(obj).String()
+	p.statusesLock.Lock()
+	_, pending := p.pending[key]
+	if !pending {
+		delete(p.statuses, key)
+		if err := p.store.Delete(obj); err != nil {
+			p.logger.Error(err, "Failed to remove object from the cache", "object", key)
+		}
+	}
+	p.statusesLock.Unlock()
+
+	if !pending {
+		p.updateInventoryMetrics()
+	}
+}
+
+func (p *CachedProxyResolver) KnownPaths() map[string]struct{} {
+	p.statusesLock.RLock()
+	defer p.statusesLock.RUnlock()
+
+	paths := make(map[string]struct{}, len(p.statuses)+len(p.pending))
+	for _, status := range p.statuses {
+		if status.File != nil && status.File.Path != nil && !status.Deleted {
+			paths[*status.File.Path] = struct{}{}
+		}
+	}
+	for _, op := range p.pending {
+		if path, err := BuildPath(op.object); err == nil {
+			paths[path] = struct{}{}
+		}
+		if op.object.Status.Path != "" {
+			paths[op.object.Status.Path] = struct{}{}
+		}
+	}
+	return paths
+}
+
+func (p *CachedProxyResolver) StatusUpdates() <-chan event.GenericEvent {
+	return p.statusUpdates
+}
+
 func (p *CachedProxyResolver) NeedLeaderElection() bool {
 	if p.dbmode == "off" {
 		return false
@@ -169,6 +253,14 @@ func (p *CachedProxyResolver) NeedLeaderElection() bool {
 }
 
 func (p *CachedProxyResolver) Start(ctx context.Context) error {
+	if p.enableReverseSync {
+		p.logger.Info("Reverse sync enabled, files in Kong will be compared with the objects", "period", p.resyncPeriod, "policy", p.driftPolicy)
+		go p.resync(ctx)
+	}
+	// the proxy is started once the caches are synced, its files are dumped from then on, even before
+	// a file is applied
+	p.dumpConfig()
+	p.runWorkers(ctx)
 	return nil
 }
 
@@ -235,6 +327,48 @@ func (p *CachedProxyResolver) initialize() error {
 	return nil
 }
 
+// apply writes the expected file to Kong, unless Kong already holds the same contents: the checksum
+// of the contents is compared with the last applied one or, when the object was never applied
+// (e.g. on startup), with the checksum of the contents currently in Kong.
+func (p *CachedProxyResolver) apply(ctx context.Context, obj *developer.KongFile, expected *services.File) (*services.File, string, error) {
+	checksum := Checksum(*expected.Contents)
+
+	status, _ := p.ObjectStatus(obj)
+	if status.File != nil {
+		if !status.Drifted && status.ContentsChecksum == checksum &&
+			status.File.Path != nil && *status.File.Path == *expected.Path {
+			p.logger.V(util.DebugLevel).Info("File unchanged, skipping update", "namespace", obj.GetNamespace(), "name", obj.GetName(), "path", *expected.Path)
+			return nil, "", nil
+		}
+	} else {
+		live, err := p.service.Get(ctx, expected)
+		if err != nil && !services.IsNotFound(err) {
+			return nil, "", err
+		}
+		if err == nil && live.Contents != nil && Checksum(*live.Contents) == checksum {
+			p.logger.V(util.DebugLevel).Info("File already up to date in Kong, skipping update", "namespace", obj.GetNamespace(), "name", obj.GetName(), "path", *expected.Path)
+			return recordedFile(expected, live), checksum, nil
+		}
+	}
+
+	file, err := p.service.Update(ctx, expected)
+	if err != nil {
+		return nil, "", err
+	}
+	return recordedFile(expected, file), checksum, nil
+}
+
+// recordedFile provides the file to record in the status, contents are not kept in memory
+// since the checksum is enough to detect changes.
+func recordedFile(expected, file *services.File) *services.File {
+	recorded := *file
+	recorded.Contents = nil
+	if recorded.Path == nil {
+		recorded.Path = expected.Path
+	}
+	return &recorded
+}
+
 // kongRootWithTimeout provides the root developer from Kong, but uses a configurable timeout to avoid long waits if the Admin API
 // is not yet ready to respond. If a timeout error occurs, the caller is responsible for providing a retry mechanism.
 func (p *CachedProxyResolver) kongRootWithTimeout() (map[string]interface{}, error) {
@@ -243,26 +377,187 @@ func (p *CachedProxyResolver) kongRootWithTimeout() (map[string]interface{}, err
 	return p.kongConfig.Client.Root(ctx)
 }
 
+// KongPathIndexKey is the name of the manager cache index of KongFiles by the path of their file in Kong.
+const KongPathIndexKey = "kongPath"
+
+// KongPathIndexer indexes KongFiles by the path of their file in Kong, see KongPathIndexKey: the path built
+// from their spec, as well as the path recorded in their status while they still publish a file there.
+func KongPathIndexer(obj client.Object) []string {
+	kongFile, ok := obj.(*developer.KongFile)
+	if !ok {
+		return nil
+	}
+	var paths []string
+	if path, err := BuildPath(kongFile); err == nil {
+		paths = append(paths, path)
+	}
+	if path := kongFile.Status.Path; path != "" && (len(paths) == 0 || paths[0] != path) {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// OwnsPathBefore indicates whether a KongFile takes precedence over another one for the file at the path in Kong.
+// The KongFile publishing the file, as recorded in its status, owns the path until its move or deletion is applied,
+// regardless of its age. Otherwise, the oldest KongFile owns the path.
+func OwnsPathBefore(kongFile, other *developer.KongFile, path string) bool {
+	if published, otherPublished := kongFile.Status.Path == path, other.Status.Path == path; published != otherPublished {
+		return published
+	}
+	return isOlder(kongFile, other)
+}
+
+// isOlder indicates whether a KongFile was created before another one, objects being created being the newest.
+// Objects created in the same second are ordered by namespace and name.
+func isOlder(kongFile, other *developer.KongFile) bool {
+	if kongFile.CreationTimestamp.IsZero() != other.CreationTimestamp.IsZero() {
+		return other.CreationTimestamp.IsZero()
+	}
+	if !kongFile.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return kongFile.CreationTimestamp.Before(&other.CreationTimestamp)
+	}
+	return client.ObjectKeyFromObject(kongFile).String() < client.ObjectKeyFromObject(other).String()
+}
+
 // Build file object
-func Build(kongFile *developer.KongFile) (file *services.File) {
+func Build(kongFile *developer.KongFile) (*services.File, error) {
+	expectedPath, err := BuildPath(kongFile)
+	if err != nil {
+		return nil, err
+	}
+
 	var expectedContent string
-	var expectedPath string
 	if kongFile.Spec.Kind == developer.CONTENT {
-		expectedPath = "content/" + kongFile.Spec.Path + "/" + kongFile.Spec.Name
 		expectedContent = "---\n" +
 			"title: " + kongFile.Spec.Title + "\n" +
 			"layout: " + kongFile.Spec.Layout + "\n" +
 			"---\n" +
 			kongFile.Spec.Content
-	} else if kongFile.Spec.Kind == developer.ASSET {
-		expectedPath = "base/assets/" + kongFile.Spec.Path + "/" + kongFile.Spec.Name
-		expectedContent = kongFile.Spec.Content
-	} else if kongFile.Spec.Kind == developer.SPECIFICATION {
-		expectedPath = "specs/" + kongFile.Spec.Path + "/" + kongFile.Spec.Name
+	} else if len(kongFile.Spec.BinaryContent) > 0 {
+		expectedContent = EncodeBinaryContent(kongFile.Spec.Name, kongFile.Spec.BinaryContent)
+	} else {
 		expectedContent = kongFile.Spec.Content
 	}
 	return &services.File{
 		Path:     &expectedPath,
 		Contents: &expectedContent,
+	}, nil
+}
+
+// KindOfPath provides the kind of the KongFiles published at the path in Kong, or under the path prefix,
+// empty when the path is not in the directory of a kind.
+func KindOfPath(path string) string {
+	for kind, root := range kindRoots {
+		if strings.HasPrefix(path, root) {
+			return string(kind)
+		}
+	}
+	return ""
+}
+
+// kindRoots are the directories of the Kong portal files of each kind.
+var kindRoots = map[developer.Kind]string{
+	developer.CONTENT:       "content/",
+	developer.ASSET:         "base/assets/",
+	developer.SPECIFICATION: "specs/",
+}
+
+// SizeLimits are the maximum sizes of the file contents of each kind, in bytes. Kinds without limit are unbounded.
+type SizeLimits map[developer.Kind]int64
+
+// ParseSizeLimits validates the provided size limits, indexed by kind.
+func ParseSizeLimits(limits map[string]int64) (SizeLimits, error) {
+	sizeLimits := make(SizeLimits, len(limits))
+	for kind, limit := range limits {
+		if _, ok := kindRoots[developer.Kind(kind)]; !ok {
+			return nil, fmt.Errorf("unsupported kind %q in size limits", kind)
+		}
+		if limit <= 0 {
+			return nil, fmt.Errorf("size limit of kind %s must be positive, got %d", kind, limit)
+		}
+		sizeLimits[developer.Kind(kind)] = limit
+	}
+	return sizeLimits, nil
+}
+
+// Check refuses file contents exceeding the size limit of their kind, see ContentSize.
+func (l SizeLimits) Check(spec *developer.KongFileSpec, contents string) error {
+	size := ContentSize(spec, contents)
+	if limit, ok := l[spec.Kind]; ok && int64(size) > limit {
+		return fmt.Errorf("file contents of %d bytes exceed the %d bytes limit of kind %s", size, limit, spec.Kind)
+	}
+	return nil
+}
+
+// ContentSize provides the size of the file contents built from the spec, in bytes, binary contents being
+// measured as is rather than as the data URL they are published as.
+func ContentSize(spec *developer.KongFileSpec, contents string) int {
+	if len(spec.BinaryContent) > 0 {
+		return len(spec.BinaryContent)
+	}
+	return len(contents)
+}
+
+// BuildPath provides the normalized path of the file of a KongFile in Kong. Empty and "." segments
+// of spec.path are dropped, while segments which could escape the root directory of the kind are
+// refused, as well as names which are not a single path segment.
+func BuildPath(kongFile *developer.KongFile) (string, error) {
+	root, ok := kindRoots[kongFile.Spec.Kind]
+	if !ok {
+		return "", fmt.Errorf("unsupported kind %q", kongFile.Spec.Kind)
 	}
+
+	if err := ValidatePath(kongFile.Spec.Path); err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", kongFile.Spec.Path, err)
+	}
+	if err := ValidateName(kongFile.Spec.Name); err != nil {
+		return "", fmt.Errorf("invalid name %q: %w", kongFile.Spec.Name, err)
+	}
+
+	segments := pathSegments(kongFile.Spec.Path)
+	return root + strings.Join(append(segments, kongFile.Spec.Name), "/"), nil
+}
+
+// ValidatePath checks that no segment of a KongFile spec.path escapes the root directory of its kind.
+func ValidatePath(path string) error {
+	for _, segment := range pathSegments(path) {
+		if err := validateSegment(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateName checks that a KongFile spec.name is a single valid path segment.
+func ValidateName(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "/") {
+		return fmt.Errorf("must be a single path segment")
+	}
+	return validateSegment(name)
+}
+
+// pathSegments provides the segments of a KongFile spec.path, dropping the empty and "." ones.
+func pathSegments(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// validateSegment refuses path segments escaping their parent directory or holding characters
+// which Kong could interpret differently from a plain file name.
+func validateSegment(segment string) error {
+	if segment == ".." {
+		return fmt.Errorf("%q segments are not allowed", segment)
+	}
+	for _, r := range segment {
+		if r == '\\' || unicode.IsControl(r) {
+			return fmt.Errorf("segment %q holds a forbidden character %q", segment, r)
+		}
+	}
+	return nil
 }
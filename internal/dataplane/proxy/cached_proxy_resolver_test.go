@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+func TestBuildPath(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		kind     developer.Kind
+		path     string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{name: "content", kind: developer.CONTENT, path: "guides", fileName: "index.md", want: "content/guides/index.md"},
+		{name: "asset", kind: developer.ASSET, path: "images", fileName: "logo.png", want: "base/assets/images/logo.png"},
+		{name: "specification", kind: developer.SPECIFICATION, path: "", fileName: "petstore.yaml", want: "specs/petstore.yaml"},
+		{name: "nested path", kind: developer.CONTENT, path: "a/b/c", fileName: "d.md", want: "content/a/b/c/d.md"},
+		{name: "empty segments", kind: developer.CONTENT, path: "/a//b/", fileName: "c.md", want: "content/a/b/c.md"},
+		{name: "dot segments", kind: developer.CONTENT, path: "./a/./b", fileName: "c.md", want: "content/a/b/c.md"},
+		{name: "spaces", kind: developer.CONTENT, path: "getting started", fileName: "first steps.md", want: "content/getting started/first steps.md"},
+		{name: "question mark", kind: developer.CONTENT, path: "faq", fileName: "why?.md", want: "content/faq/why?.md"},
+		{name: "parent segment", kind: developer.CONTENT, path: "../specs", fileName: "petstore.yaml", wantErr: true},
+		{name: "nested parent segment", kind: developer.CONTENT, path: "a/../../specs", fileName: "petstore.yaml", wantErr: true},
+		{name: "backslash in path", kind: developer.CONTENT, path: `a\..`, fileName: "b.md", wantErr: true},
+		{name: "control character in path", kind: developer.CONTENT, path: "a\nb", fileName: "c.md", wantErr: true},
+		{name: "parent name", kind: developer.CONTENT, path: "a", fileName: "..", wantErr: true},
+		{name: "name with slash", kind: developer.CONTENT, path: "a", fileName: "b/c.md", wantErr: true},
+		{name: "empty name", kind: developer.CONTENT, path: "a", fileName: "", wantErr: true},
+		{name: "unsupported kind", kind: developer.Kind("THEME"), path: "a", fileName: "b.md", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kongFile := &developer.KongFile{Spec: developer.KongFileSpec{Kind: tt.kind, Path: tt.path, Name: tt.fileName}}
+			got, err := BuildPath(kongFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("BuildPath() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPath() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("BuildPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	for _, tt := range []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: ""},
+		{path: "/"},
+		{path: "a/b"},
+		{path: "./a"},
+		{path: "a//b"},
+		{path: "a/./b"},
+		{path: "getting started"},
+		{path: "faq?"},
+		{path: "..a/b.."},
+		{path: "..", wantErr: true},
+		{path: "a/..", wantErr: true},
+		{path: "../a", wantErr: true},
+		{path: "a/../b", wantErr: true},
+		{path: `a\b`, wantErr: true},
+		{path: `..\a`, wantErr: true},
+		{path: "a\x00b", wantErr: true},
+		{path: "a\tb", wantErr: true},
+		{path: "a\x7fb", wantErr: true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			err := ValidatePath(tt.path)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("ValidatePath(%q) error = %v, want error %t", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "index.md"},
+		{name: "first steps.md"},
+		{name: "why?.md"},
+		{name: ".hidden"},
+		{name: "..md"},
+		{name: "", wantErr: true},
+		{name: ".", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "./a.md", wantErr: true},
+		{name: "a/b.md", wantErr: true},
+		{name: "a/", wantErr: true},
+		{name: `a\b.md`, wantErr: true},
+		{name: "a\rb.md", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.name)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("ValidateName(%q) error = %v, want error %t", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKindOfPath(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{path: "content/guides/index.md", want: string(developer.CONTENT)},
+		{path: "base/assets/logo.png", want: string(developer.ASSET)},
+		{path: "specs/petstore.yaml", want: string(developer.SPECIFICATION)},
+		{path: "themes/base/layouts/index.html", want: ""},
+		{path: "", want: ""},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := KindOfPath(tt.path); got != tt.want {
+				t.Errorf("KindOfPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySkipsUnchangedFiles(t *testing.T) {
+	const published = "---\ntitle: Guide\nlayout: page\n---\n# Guide"
+	for _, tt := range []struct {
+		name      string
+		inKong    string
+		applied   bool
+		drifted   bool
+		content   string
+		wantCalls []string
+	}{
+		{
+			name:      "never applied, same file in Kong",
+			inKong:    published,
+			content:   "# Guide",
+			wantCalls: []string{"GET content/guides/guide.md"},
+		},
+		{
+			name:      "never applied, different file in Kong",
+			inKong:    "outdated",
+			content:   "# Guide",
+			wantCalls: []string{"GET content/guides/guide.md", "PATCH content/guides/guide.md"},
+		},
+		{
+			name:      "never applied, no file in Kong",
+			content:   "# Guide",
+			wantCalls: []string{"GET content/guides/guide.md", "PATCH content/guides/guide.md"},
+		},
+		{
+			name:    "applied, same checksum",
+			applied: true,
+			content: "# Guide",
+		},
+		{
+			name:      "applied, different checksum",
+			applied:   true,
+			content:   "# Updated guide",
+			wantCalls: []string{"PATCH content/guides/guide.md"},
+		},
+		{
+			name:      "applied, drifted",
+			applied:   true,
+			drifted:   true,
+			content:   "# Guide",
+			wantCalls: []string{"PATCH content/guides/guide.md"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newFakeFileService()
+			p := newTestProxy(t, service)
+			if tt.inKong != "" {
+				service.files["content/guides/guide.md"] = tt.inKong
+			}
+			if tt.applied {
+				if err := p.UpdateObject(testContentFile("guide", 1, "# Guide")); err != nil {
+					t.Fatalf("UpdateObject() unexpected error: %v", err)
+				}
+				processQueued(t, p)
+				service.calls = nil
+			}
+			if tt.drifted {
+				p.setObjectDrifted(context.Background(), testContentFile("guide", 1, ""), true)
+			}
+
+			obj := testContentFile("guide", 2, tt.content)
+			if err := p.UpdateObject(obj); err != nil {
+				t.Fatalf("UpdateObject() unexpected error: %v", err)
+			}
+			processQueued(t, p)
+
+			if !equalStrings(service.calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", service.calls, tt.wantCalls)
+			}
+			status, _ := p.ObjectStatus(obj)
+			if status.Err != nil || status.File == nil || status.Drifted {
+				t.Errorf("ObjectStatus() = %+v, want the file recorded as published", status)
+			}
+			if want := Checksum(service.files["content/guides/guide.md"]); status.ContentsChecksum != want {
+				t.Errorf("ObjectStatus().ContentsChecksum = %q, want %q", status.ContentsChecksum, want)
+			}
+		})
+	}
+}
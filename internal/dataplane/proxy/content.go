@@ -0,0 +1,464 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kong-portal-controller/internal/annotations"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// -----------------------------------------------------------------------------
+// Content Sources - Public Types
+// -----------------------------------------------------------------------------
+
+// ContentRefError reports a KongFile spec.contentFrom which cannot be resolved.
+type ContentRefError struct {
+	// Ref describes the source of the content, such as ConfigMap name[key]
+	Ref string
+	// NotFound indicates whether the source does not exist, rather than being invalid
+	NotFound bool
+	Err      error
+}
+
+func (e *ContentRefError) Error() string {
+	return fmt.Sprintf("content of %s: %v", e.Ref, e.Err)
+}
+
+func (e *ContentRefError) Unwrap() error {
+	return e.Err
+}
+
+// ContentEncodingError reports a KongFile content which cannot be decoded according to spec.contentEncoding.
+type ContentEncodingError struct {
+	// Ref describes the source of the content, as in ContentRefError
+	Ref      string
+	Encoding developer.ContentEncoding
+	Err      error
+}
+
+func (e *ContentEncodingError) Error() string {
+	return fmt.Sprintf("%s is not valid %s: %v", e.Ref, e.Encoding, e.Err)
+}
+
+func (e *ContentEncodingError) Unwrap() error {
+	return e.Err
+}
+
+// ErrSecretNotContentSource reports a Secret which did not opt in to be published by KongFiles, with
+// the annotations.ContentSourceKey annotation. Secrets are private, KongFiles publish their data to the portal.
+var ErrSecretNotContentSource = fmt.Errorf("the Secret is not annotated with %s=\"true\"", annotations.ContentSourceKey)
+
+// ContentRefIndexKey is the name of the manager cache index of KongFiles by the ConfigMap or Secret
+// their content is read from.
+const ContentRefIndexKey = "contentRef"
+
+// ContentRefIndexer indexes KongFiles by the ConfigMap or Secret their content is read from, see ContentRefIndexKey.
+func ContentRefIndexer(obj client.Object) []string {
+	kongFile, ok := obj.(*developer.KongFile)
+	if !ok || kongFile.Spec.ContentFrom == nil {
+		return nil
+	}
+	source := kongFile.Spec.ContentFrom
+	switch {
+	case source.ConfigMapKeyRef != nil:
+		return []string{ContentRef("ConfigMap", source.ConfigMapKeyRef.Name)}
+	case source.SecretKeyRef != nil:
+		return []string{ContentRef("Secret", source.SecretKeyRef.Name)}
+	}
+	return nil
+}
+
+// ContentRef provides the value of ContentRefIndexKey for the object of the provided kind and name,
+// in the namespace of the KongFiles.
+func ContentRef(kind, name string) string {
+	return kind + "/" + name
+}
+
+// -----------------------------------------------------------------------------
+// Content Sources - Public Functions
+// -----------------------------------------------------------------------------
+
+// ValidateContentSource checks that a KongFile spec.contentFrom selects exactly one source,
+// instead of an inline spec.content or spec.binaryContent, the latter being only supported by ASSET files
+// and not encoded.
+func ValidateContentSource(spec *developer.KongFileSpec) error {
+	if spec.ContentEncoding != "" && spec.ContentEncoding != developer.ContentEncodingGzipBase64 {
+		return fmt.Errorf("unsupported contentEncoding %q, expected %s", spec.ContentEncoding, developer.ContentEncodingGzipBase64)
+	}
+	if len(spec.BinaryContent) > 0 {
+		if spec.ContentEncoding != "" {
+			return errors.New("binaryContent cannot be encoded")
+		}
+		if spec.Kind != developer.ASSET {
+			return fmt.Errorf("binaryContent is only supported by %s files", developer.ASSET)
+		}
+		if spec.Content != "" || spec.ContentFrom != nil {
+			return errors.New("binaryContent is mutually exclusive with content and contentFrom")
+		}
+	}
+	source := spec.ContentFrom
+	if source == nil {
+		return nil
+	}
+	if spec.Content != "" {
+		return errors.New("content and contentFrom are mutually exclusive")
+	}
+
+	sources := 0
+	if source.ConfigMapKeyRef != nil {
+		sources++
+		if source.ConfigMapKeyRef.Name == "" || source.ConfigMapKeyRef.Key == "" {
+			return errors.New("contentFrom.configMapKeyRef requires a name and a key")
+		}
+	}
+	if source.SecretKeyRef != nil {
+		sources++
+		if source.SecretKeyRef.Name == "" || source.SecretKeyRef.Key == "" {
+			return errors.New("contentFrom.secretKeyRef requires a name and a key")
+		}
+	}
+	if source.File != "" {
+		sources++
+		if err := ValidateContentFile(source.File); err != nil {
+			return fmt.Errorf("invalid contentFrom.file %q: %w", source.File, err)
+		}
+	}
+	if sources != 1 {
+		return errors.New("contentFrom requires exactly one of configMapKeyRef, secretKeyRef or file")
+	}
+	return nil
+}
+
+// ValidateContentFile checks that a KongFile spec.contentFrom.file stays within the content root.
+func ValidateContentFile(file string) error {
+	if filepath.IsAbs(file) {
+		return errors.New("must be relative to the content root")
+	}
+	if cleaned := filepath.Clean(file); cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return errors.New("must name a file within the content root")
+	}
+	return nil
+}
+
+// ResolveContent provides a copy of the KongFile holding its decoded content inline, read from the source
+// selected by spec.contentFrom when set. Files are read relative to the content root, and are not available
+// without one. Optional ConfigMap and Secret keys which do not exist provide an empty content. The binaryData
+// of ConfigMaps and the data which is not UTF-8 text are held in spec.binaryContent.
+func ResolveContent(ctx context.Context, reader client.Reader, root string, kongFile *developer.KongFile) (*developer.KongFile, error) {
+	resolved := kongFile.DeepCopy()
+	if kongFile.Spec.ContentFrom == nil && kongFile.Spec.ContentEncoding == "" {
+		return resolved, nil
+	}
+	if err := ValidateContentSource(&kongFile.Spec); err != nil {
+		return nil, &ContentRefError{Ref: "spec", Err: err}
+	}
+	resolved.Spec.ContentFrom = nil
+	resolved.Spec.ContentEncoding = ""
+
+	ref, data, binary := "content", []byte(kongFile.Spec.Content), false
+	if kongFile.Spec.ContentFrom != nil {
+		var err error
+		if ref, data, binary, err = readContentSource(ctx, reader, root, kongFile); err != nil {
+			return nil, err
+		}
+	}
+	if kongFile.Spec.ContentEncoding != "" {
+		var err error
+		if data, err = DecodeContent(kongFile.Spec.ContentEncoding, data); err != nil {
+			return nil, &ContentEncodingError{Ref: ref, Encoding: kongFile.Spec.ContentEncoding, Err: err}
+		}
+		binary = false
+	}
+
+	resolved.Spec.Content = ""
+	if !binary && utf8.Valid(data) {
+		resolved.Spec.Content = string(data)
+		return resolved, nil
+	}
+	if kongFile.Spec.Kind != developer.ASSET {
+		err := fmt.Errorf("binary data is only supported by %s files", developer.ASSET)
+		if kongFile.Spec.ContentFrom == nil {
+			// only decoded inline contents can be binary
+			return nil, &ContentEncodingError{Ref: ref, Encoding: kongFile.Spec.ContentEncoding, Err: err}
+		}
+		return nil, &ContentRefError{Ref: ref, Err: err}
+	}
+	resolved.Spec.BinaryContent = data
+	return resolved, nil
+}
+
+// ContentChecksum provides the checksum of the inline or binary content of a KongFile.
+func ContentChecksum(spec *developer.KongFileSpec) string {
+	if len(spec.BinaryContent) > 0 {
+		return Checksum(string(spec.BinaryContent))
+	}
+	return Checksum(spec.Content)
+}
+
+// MaxDecodedContentSize is the maximum size of a decoded content, in bytes, so that small compressed contents
+// cannot exhaust the memory of the controller.
+const MaxDecodedContentSize = 64 << 20
+
+// DecodeContent decodes a content according to its encoding, an empty content being left as is.
+func DecodeContent(encoding developer.ContentEncoding, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch encoding {
+	case "":
+		return data, nil
+	case developer.ContentEncodingGzipBase64:
+		compressed := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+		n, err := base64.StdEncoding.Decode(compressed, bytes.TrimSpace(data))
+		if err != nil {
+			return nil, fmt.Errorf("base64: %w", err)
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed[:n]))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer reader.Close()
+		decoded, err := io.ReadAll(io.LimitReader(reader, MaxDecodedContentSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		if len(decoded) > MaxDecodedContentSize {
+			return nil, fmt.Errorf("decoded content exceeds %d bytes", MaxDecodedContentSize)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// EncodeContent encodes a content according to the encoding, DecodeContent providing the content back.
+func EncodeContent(encoding developer.ContentEncoding, data []byte) ([]byte, error) {
+	switch encoding {
+	case "":
+		return data, nil
+	case developer.ContentEncodingGzipBase64:
+		var compressed bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(compressed.Len()))
+		base64.StdEncoding.Encode(encoded, compressed.Bytes())
+		return encoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// ContentFilePath provides the path of a KongFile spec.contentFrom.file on disk, refusing the ones
+// which resolve outside of the content root through symbolic links.
+func ContentFilePath(root, file string) (string, error) {
+	ref := "file " + file
+	if root == "" {
+		return "", &ContentRefError{Ref: ref, Err: errors.New("the controller has no content root")}
+	}
+	if err := ValidateContentFile(file); err != nil {
+		return "", &ContentRefError{Ref: ref, Err: err}
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the content root %q: %w", root, err)
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(resolvedRoot, file))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", &ContentRefError{Ref: ref, NotFound: true, Err: errors.New("file not found")}
+	} else if err != nil {
+		return "", &ContentRefError{Ref: ref, Err: err}
+	}
+	if relative, err := filepath.Rel(resolvedRoot, path); err != nil || relative == ".." || strings.HasPrefix(relative, "../") {
+		return "", &ContentRefError{Ref: ref, Err: errors.New("resolves outside of the content root")}
+	}
+	return path, nil
+}
+
+// -----------------------------------------------------------------------------
+// Content Sources - Private Functions
+// -----------------------------------------------------------------------------
+
+// readContentSource reads the data selected by spec.contentFrom, describing its source and indicating
+// whether it is binary data.
+func readContentSource(
+	ctx context.Context,
+	reader client.Reader,
+	root string,
+	kongFile *developer.KongFile,
+) (ref string, data []byte, binary bool, err error) {
+	source := kongFile.Spec.ContentFrom
+	var optional *bool
+	switch {
+	case source.ConfigMapKeyRef != nil:
+		keyRef := source.ConfigMapKeyRef
+		configMap := new(corev1.ConfigMap)
+		ref, optional = fmt.Sprintf("ConfigMap %s[%s]", keyRef.Name, keyRef.Key), keyRef.Optional
+		data, binary, err = getKey(ctx, reader, kongFile.Namespace, keyRef.Name, ref, configMap, nil, func() ([]byte, bool, bool) {
+			if value, ok := configMap.Data[keyRef.Key]; ok {
+				return []byte(value), false, true
+			}
+			value, ok := configMap.BinaryData[keyRef.Key]
+			return value, true, ok
+		})
+	case source.SecretKeyRef != nil:
+		keyRef := source.SecretKeyRef
+		secret := new(corev1.Secret)
+		ref, optional = fmt.Sprintf("Secret %s[%s]", keyRef.Name, keyRef.Key), keyRef.Optional
+		data, binary, err = getKey(ctx, reader, kongFile.Namespace, keyRef.Name, ref, secret, func() error {
+			if secret.Annotations[annotations.ContentSourceKey] != "true" {
+				return ErrSecretNotContentSource
+			}
+			return nil
+		}, func() ([]byte, bool, bool) {
+			value, ok := secret.Data[keyRef.Key]
+			return value, false, ok
+		})
+	default:
+		ref = "file " + source.File
+		var path string
+		if path, err = ContentFilePath(root, source.File); err == nil {
+			if data, err = os.ReadFile(path); err != nil {
+				err = &ContentRefError{Ref: ref, NotFound: errors.Is(err, os.ErrNotExist), Err: err}
+			}
+		}
+	}
+	if isOptional(err, optional) {
+		return ref, nil, false, nil
+	}
+	return ref, data, binary, err
+}
+
+// getKey reads the key of the named object, using the provided lookup once the object is fetched and allowed
+// by the check, if any. The lookup also indicates whether the value is binary data.
+func getKey(
+	ctx context.Context,
+	reader client.Reader,
+	namespace, name, ref string,
+	obj client.Object,
+	check func() error,
+	lookup func() ([]byte, bool, bool),
+) ([]byte, bool, error) {
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, &ContentRefError{Ref: ref, NotFound: true, Err: fmt.Errorf("%q not found", name)}
+		}
+		return nil, false, fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			return nil, false, &ContentRefError{Ref: ref, Err: err}
+		}
+	}
+	value, binary, ok := lookup()
+	if !ok {
+		return nil, false, &ContentRefError{Ref: ref, NotFound: true, Err: errors.New("key not found")}
+	}
+	return value, binary, nil
+}
+
+// isOptional indicates whether the error reports an optional source which does not exist, standing for an empty content.
+func isOptional(err error, optional *bool) bool {
+	var refErr *ContentRefError
+	return errors.As(err, &refErr) && refErr.NotFound && optional != nil && *optional
+}
+
+// -----------------------------------------------------------------------------
+// Binary Content - Public Functions
+// -----------------------------------------------------------------------------
+
+// DefaultContentType is the type of the binary contents which cannot be detected.
+const DefaultContentType = "application/octet-stream"
+
+// extensionContentTypes are the types detected from the binary contents of the files with well known extensions,
+// the system MIME types of some of them being aliases.
+var extensionContentTypes = map[string][]string{
+	".avif":  {"image/avif"},
+	".bmp":   {"image/bmp"},
+	".gif":   {"image/gif"},
+	".ico":   {"image/x-icon"},
+	".jpeg":  {"image/jpeg"},
+	".jpg":   {"image/jpeg"},
+	".png":   {"image/png"},
+	".webp":  {"image/webp"},
+	".otf":   {"font/otf"},
+	".ttf":   {"font/ttf", "font/collection"},
+	".woff":  {"font/woff"},
+	".woff2": {"font/woff2"},
+	".pdf":   {"application/pdf"},
+	".zip":   {"application/zip"},
+	".gz":    {"application/x-gzip"},
+	".mp3":   {"audio/mpeg"},
+	".mp4":   {"video/mp4"},
+	".webm":  {"video/webm"},
+	".wasm":  {"application/wasm"},
+}
+
+// DetectContentType provides the MIME type of the binary contents of the named file, sniffed from the contents
+// or, when they are not recognized, derived from the extension of the name.
+func DetectContentType(name string, data []byte) string {
+	if detected := SniffContentType(data); detected != DefaultContentType {
+		return detected
+	}
+	if types := ExtensionContentTypes(name); len(types) > 0 {
+		return types[0]
+	}
+	return DefaultContentType
+}
+
+// SniffContentType provides the MIME type detected from binary contents, without parameters.
+func SniffContentType(data []byte) string {
+	detected := http.DetectContentType(data)
+	if mediaType, _, err := mime.ParseMediaType(detected); err == nil {
+		detected = mediaType
+	}
+	if strings.HasPrefix(detected, "text/") {
+		// binary contents are not text, even when they happen to start like it
+		return DefaultContentType
+	}
+	return detected
+}
+
+// ExtensionContentTypes provides the MIME types expected for the extension of the named file, if it is known.
+func ExtensionContentTypes(name string) []string {
+	extension := strings.ToLower(filepath.Ext(name))
+	if types, ok := extensionContentTypes[extension]; ok {
+		return types
+	}
+	if extensionType := mime.TypeByExtension(extension); extensionType != "" {
+		if mediaType, _, err := mime.ParseMediaType(extensionType); err == nil {
+			return []string{mediaType}
+		}
+	}
+	return nil
+}
+
+// EncodeBinaryContent provides the contents of a binary file as published in Kong: a data URL
+// holding the contents encoded in base64.
+func EncodeBinaryContent(name string, data []byte) string {
+	return "data:" + DetectContentType(name, data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
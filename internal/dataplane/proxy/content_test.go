@@ -0,0 +1,274 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+func TestEncodeContentRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		encoding developer.ContentEncoding
+		data     []byte
+	}{
+		{name: "plain", data: []byte("# Title\n")},
+		{name: "gzip text", encoding: developer.ContentEncodingGzipBase64, data: []byte("# Title\n")},
+		{name: "gzip binary", encoding: developer.ContentEncodingGzipBase64, data: []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}},
+		{name: "gzip large", encoding: developer.ContentEncodingGzipBase64, data: bytes.Repeat([]byte("portal "), 1<<16)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := EncodeContent(tt.encoding, tt.data)
+			if err != nil {
+				t.Fatalf("EncodeContent() unexpected error: %v", err)
+			}
+			decoded, err := DecodeContent(tt.encoding, encoded)
+			if err != nil {
+				t.Fatalf("DecodeContent() unexpected error: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.data) {
+				t.Errorf("DecodeContent(EncodeContent()) = %q, want %q", decoded, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	gzipBase64 := func(data []byte) []byte {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return []byte(base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	}
+
+	for _, tt := range []struct {
+		name     string
+		encoding developer.ContentEncoding
+		data     []byte
+		want     []byte
+		wantErr  string
+	}{
+		{name: "empty", encoding: developer.ContentEncodingGzipBase64, data: []byte{}, want: []byte{}},
+		{name: "plain", data: []byte("text"), want: []byte("text")},
+		{name: "gzip", encoding: developer.ContentEncodingGzipBase64, data: gzipBase64([]byte("text")), want: []byte("text")},
+		{name: "surrounding whitespace", encoding: developer.ContentEncodingGzipBase64,
+			data: append(append([]byte("\n  "), gzipBase64([]byte("text"))...), '\n'), want: []byte("text")},
+		{name: "invalid base64", encoding: developer.ContentEncodingGzipBase64, data: []byte("not base64!"), wantErr: "base64"},
+		{name: "not gzip", encoding: developer.ContentEncodingGzipBase64,
+			data: []byte(base64.StdEncoding.EncodeToString([]byte("plain text"))), wantErr: "gzip"},
+		{name: "truncated gzip", encoding: developer.ContentEncodingGzipBase64,
+			data: []byte(base64.StdEncoding.EncodeToString(mustDecodeBase64(t, gzipBase64([]byte("text")))[:12])), wantErr: "gzip"},
+		{name: "exceeds limit", encoding: developer.ContentEncodingGzipBase64,
+			data: gzipBase64(make([]byte, MaxDecodedContentSize+1)), wantErr: "exceeds"},
+		{name: "unsupported encoding", encoding: developer.ContentEncoding("zstd"), data: []byte("text"), wantErr: "unsupported"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeContent(tt.encoding, tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DecodeContent() error = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeContent() unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("DecodeContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveContentEncoding(t *testing.T) {
+	text, err := EncodeContent(developer.ContentEncodingGzipBase64, []byte("# Title\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := EncodeContent(developer.ContentEncodingGzipBase64, []byte{0xff, 0xfe, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		kind        developer.Kind
+		content     string
+		wantContent string
+		wantBinary  []byte
+		wantErr     bool
+	}{
+		{name: "text", kind: developer.CONTENT, content: string(text), wantContent: "# Title\n"},
+		{name: "binary asset", kind: developer.ASSET, content: string(binary), wantBinary: []byte{0xff, 0xfe, 0x00}},
+		{name: "binary content", kind: developer.CONTENT, content: string(binary), wantErr: true},
+		{name: "invalid", kind: developer.CONTENT, content: "not base64!", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kongFile := &developer.KongFile{Spec: developer.KongFileSpec{
+				Kind:            tt.kind,
+				Name:            "file",
+				Content:         tt.content,
+				ContentEncoding: developer.ContentEncodingGzipBase64,
+			}}
+			resolved, err := ResolveContent(context.Background(), nil, "", kongFile)
+			if tt.wantErr {
+				var encodingErr *ContentEncodingError
+				if !errors.As(err, &encodingErr) {
+					t.Fatalf("ResolveContent() error = %v, want a ContentEncodingError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveContent() unexpected error: %v", err)
+			}
+			if resolved.Spec.ContentEncoding != "" {
+				t.Errorf("ResolveContent() contentEncoding = %q, want it cleared", resolved.Spec.ContentEncoding)
+			}
+			if resolved.Spec.Content != tt.wantContent {
+				t.Errorf("ResolveContent() content = %q, want %q", resolved.Spec.Content, tt.wantContent)
+			}
+			if !bytes.Equal(resolved.Spec.BinaryContent, tt.wantBinary) {
+				t.Errorf("ResolveContent() binaryContent = %q, want %q", resolved.Spec.BinaryContent, tt.wantBinary)
+			}
+		})
+	}
+}
+
+func TestContentFilePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, file := range []string{filepath.Join(root, "docs", "index.md"), filepath.Join(outside, "secret.md")} {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("content"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.md"), filepath.Join(root, "escape.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "docs", "index.md"), filepath.Join(root, "alias.md")); err != nil {
+		t.Fatal(err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name         string
+		root         string
+		file         string
+		want         string
+		wantNotFound bool
+		wantErr      bool
+	}{
+		{name: "file", root: root, file: "docs/index.md", want: filepath.Join(resolvedRoot, "docs", "index.md")},
+		{name: "dot segments", root: root, file: "./docs/../docs/index.md", want: filepath.Join(resolvedRoot, "docs", "index.md")},
+		{name: "symbolic link within root", root: root, file: "alias.md", want: filepath.Join(resolvedRoot, "docs", "index.md")},
+		{name: "symbolic link outside root", root: root, file: "escape.md", wantErr: true},
+		{name: "parent segment", root: root, file: "../secret.md", wantErr: true},
+		{name: "absolute", root: root, file: filepath.Join(outside, "secret.md"), wantErr: true},
+		{name: "root itself", root: root, file: ".", wantErr: true},
+		{name: "missing", root: root, file: "docs/missing.md", wantNotFound: true, wantErr: true},
+		{name: "no root", root: "", file: "docs/index.md", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ContentFilePath(tt.root, tt.file)
+			if tt.wantErr {
+				var refErr *ContentRefError
+				if !errors.As(err, &refErr) {
+					t.Fatalf("ContentFilePath() error = %v, want a ContentRefError", err)
+				}
+				if refErr.NotFound != tt.wantNotFound {
+					t.Errorf("ContentFilePath() NotFound = %t, want %t", refErr.NotFound, tt.wantNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ContentFilePath() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ContentFilePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustDecodeBase64(t *testing.T, data []byte) []byte {
+	t.Helper()
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// pngHeader starts the contents of PNG images.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestEncodeBinaryContent(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		fileName string
+		data     []byte
+		want     string
+	}{
+		{name: "sniffed type", fileName: "logo.png", data: pngHeader, want: "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader)},
+		{name: "sniffed type over the extension", fileName: "logo.jpg", data: pngHeader, want: "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader)},
+		{name: "type of the extension", fileName: "font.woff2", data: []byte{0x00, 0x01, 0x02}, want: "data:font/woff2;base64,AAEC"},
+		{name: "unknown type", fileName: "blob", data: []byte{0x00, 0x01, 0x02}, want: "data:" + DefaultContentType + ";base64,AAEC"},
+		{name: "text is not sniffed", fileName: "blob", data: []byte("plain text"), want: "data:" + DefaultContentType + ";base64,cGxhaW4gdGV4dA=="},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodeBinaryContent(tt.fileName, tt.data); got != tt.want {
+				t.Errorf("EncodeBinaryContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeLimitsCheck(t *testing.T) {
+	limits := SizeLimits{developer.ASSET: 16, developer.CONTENT: 16}
+	binary := bytes.Repeat([]byte{0xff}, 16)
+	for _, tt := range []struct {
+		name     string
+		spec     developer.KongFileSpec
+		wantSize int
+		wantErr  bool
+	}{
+		{name: "text at the limit", spec: developer.KongFileSpec{Kind: developer.CONTENT, Content: strings.Repeat("a", 16)}, wantSize: 16},
+		{name: "text above the limit", spec: developer.KongFileSpec{Kind: developer.CONTENT, Content: strings.Repeat("a", 17)}, wantSize: 17, wantErr: true},
+		{name: "binary at the limit", spec: developer.KongFileSpec{Kind: developer.ASSET, Name: "logo.png", BinaryContent: binary}, wantSize: 16},
+		{name: "binary above the limit", spec: developer.KongFileSpec{Kind: developer.ASSET, Name: "logo.png", BinaryContent: append(binary, 0xff)}, wantSize: 17, wantErr: true},
+		{name: "kind without limit", spec: developer.KongFileSpec{Kind: developer.SPECIFICATION, Content: strings.Repeat("a", 64)}, wantSize: 64},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			contents := tt.spec.Content
+			if len(tt.spec.BinaryContent) > 0 {
+				// the data URL published in Kong is larger than the binary contents
+				contents = EncodeBinaryContent(tt.spec.Name, tt.spec.BinaryContent)
+			}
+			if size := ContentSize(&tt.spec, contents); size != tt.wantSize {
+				t.Errorf("ContentSize() = %d, want %d", size, tt.wantSize)
+			}
+			if err := limits.Check(&tt.spec, contents); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, want an error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
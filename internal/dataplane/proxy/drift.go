@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"kong-portal-controller/internal/annotations"
+	services "kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/util"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// -----------------------------------------------------------------------------
+// Drift Detection - Public Types
+// -----------------------------------------------------------------------------
+
+// DriftPolicy defines how the proxy handles a file in Kong which differs from its KongFile.
+type DriftPolicy string
+
+const (
+	// DriftPolicyCorrect re-applies the KongFile over the file in Kong.
+	DriftPolicyCorrect DriftPolicy = "correct"
+
+	// DriftPolicyReport only reports the drift on the KongFile status.
+	DriftPolicyReport DriftPolicy = "report"
+
+	// DriftPolicyIgnore skips the drift detection.
+	DriftPolicyIgnore DriftPolicy = "ignore"
+)
+
+// ParseDriftPolicy validates the provided drift policy.
+func ParseDriftPolicy(policy string) (DriftPolicy, error) {
+	switch DriftPolicy(policy) {
+	case DriftPolicyCorrect, DriftPolicyReport, DriftPolicyIgnore:
+		return DriftPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("%q is not a valid drift policy, expected one of %s, %s or %s",
+			policy, DriftPolicyCorrect, DriftPolicyReport, DriftPolicyIgnore)
+	}
+}
+
+// Checksum provides the checksum used to compare file contents.
+func Checksum(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+// -----------------------------------------------------------------------------
+// Drift Detection - Private Methods
+// -----------------------------------------------------------------------------
+
+// resync compares the files in Kong with the KongFiles every resync period, until the context is done.
+func (p *CachedProxyResolver) resync(ctx context.Context) {
+	ticker := time.NewTicker(p.resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkDrift(ctx)
+		}
+	}
+}
+
+// checkDrift fetches every managed file from Kong and handles the ones which differ from their KongFile.
+func (p *CachedProxyResolver) checkDrift(ctx context.Context) {
+	for _, item := range p.store.KongFiles.List() {
+		obj, ok := item.(*developer.KongFile)
+		if !ok {
+			continue
+		}
+		policy := p.driftPolicyFor(obj)
+		if policy == DriftPolicyIgnore {
+			continue
+		}
+		// the queued operation will overwrite the file anyway
+		if status, _ := p.ObjectStatus(obj); status.Pending {
+			continue
+		}
+
+		expected, err := Build(obj)
+		if err != nil {
+			continue
+		}
+		live, err := p.service.Get(ctx, expected)
+		if err != nil && !services.IsNotFound(err) {
+			p.logger.Error(err, "Failed to fetch file from Kong, skipping drift detection", "namespace", obj.Namespace, "name", obj.Name, "path", *expected.Path)
+			continue
+		}
+		if err == nil && live.Contents != nil && Checksum(*live.Contents) == Checksum(*expected.Contents) {
+			p.setObjectDrifted(ctx, obj, false)
+			continue
+		}
+
+		p.logger.Info("File in Kong differs from its KongFile", "namespace", obj.Namespace, "name", obj.Name, "path", *expected.Path, "policy", policy)
+		p.setObjectDrifted(ctx, obj, true)
+		if policy == DriftPolicyCorrect {
+			// a drifted object is always written, the queue clears the drift once applied
+			p.submit(operation{object: obj.DeepCopy()})
+		}
+	}
+	p.logger.V(util.DebugLevel).Info("Drift detection done")
+}
+
+// driftPolicyFor provides the drift policy of an object, its annotation taking precedence over the controller policy.
+func (p *CachedProxyResolver) driftPolicyFor(obj client.Object) DriftPolicy {
+	if value, ok := obj.GetAnnotations()[annotations.DriftPolicyKey]; ok {
+		policy, err := ParseDriftPolicy(value)
+		if err == nil {
+			return policy
+		}
+		p.logger.Error(err, "Invalid drift policy annotation, using the controller policy", "namespace", obj.GetNamespace(), "name", obj.GetName())
+	}
+	return p.driftPolicy
+}
+
+// setObjectDrifted records whether the object drifted, and notifies the controllers when it changed.
+func (p *CachedProxyResolver) setObjectDrifted(ctx context.Context, obj client.Object, drifted bool) {
+	key := client.ObjectKeyFromObject(obj).String()
+	p.statusesLock.Lock()
+	status, ok := p.statuses[key]
+	changed := ok && status.Drifted != drifted
+	if changed {
+		status.Drifted = drifted
+		p.statuses[key] = status
+	}
+	p.statusesLock.Unlock()
+
+	if changed {
+		p.updateInventoryMetrics()
+		p.notify(ctx, obj)
+	}
+}
+
+// notify asks the controllers to reconcile the object status with its FileStatus.
+func (p *CachedProxyResolver) notify(ctx context.Context, obj client.Object) {
+	select {
+	case p.statusUpdates <- event.GenericEvent{Object: obj}:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"kong-portal-controller/internal/annotations"
+)
+
+func TestParseDriftPolicy(t *testing.T) {
+	for _, policy := range []string{"correct", "report", "ignore"} {
+		if got, err := ParseDriftPolicy(policy); err != nil || string(got) != policy {
+			t.Errorf("ParseDriftPolicy(%q) = %q, %v, want %q", policy, got, err, policy)
+		}
+	}
+	if got, err := ParseDriftPolicy("fix"); err == nil {
+		t.Errorf("ParseDriftPolicy(%q) = %q, want an error", "fix", got)
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	const published = "---\ntitle: Guide\nlayout: page\n---\n# Guide"
+	for _, tt := range []struct {
+		name        string
+		policy      DriftPolicy
+		annotation  string
+		inKong      string
+		wantDrifted bool
+		wantFetched bool
+		wantApplied bool
+	}{
+		{name: "correct, in sync", policy: DriftPolicyCorrect, inKong: published, wantFetched: true},
+		{name: "correct, drifted", policy: DriftPolicyCorrect, inKong: "changed in Kong", wantDrifted: true, wantFetched: true, wantApplied: true},
+		{name: "correct, removed from Kong", policy: DriftPolicyCorrect, wantDrifted: true, wantFetched: true, wantApplied: true},
+		{name: "report, drifted", policy: DriftPolicyReport, inKong: "changed in Kong", wantDrifted: true, wantFetched: true},
+		{name: "ignore, drifted", policy: DriftPolicyIgnore, inKong: "changed in Kong"},
+		{name: "annotation reporting over correct", policy: DriftPolicyCorrect, annotation: "report", inKong: "changed in Kong", wantDrifted: true, wantFetched: true},
+		{name: "annotation ignoring over correct", policy: DriftPolicyCorrect, annotation: "ignore", inKong: "changed in Kong"},
+		{name: "annotation correcting over ignore", policy: DriftPolicyIgnore, annotation: "correct", inKong: "changed in Kong", wantDrifted: true, wantFetched: true, wantApplied: true},
+		{name: "invalid annotation", policy: DriftPolicyReport, annotation: "fix", inKong: "changed in Kong", wantDrifted: true, wantFetched: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newFakeFileService()
+			p := newTestProxy(t, service)
+			p.driftPolicy = tt.policy
+			obj := testContentFile("guide", 1, "# Guide")
+			if tt.annotation != "" {
+				obj.Annotations = map[string]string{annotations.DriftPolicyKey: tt.annotation}
+			}
+			if err := p.UpdateObject(obj); err != nil {
+				t.Fatalf("UpdateObject() unexpected error: %v", err)
+			}
+			processQueued(t, p)
+			<-p.statusUpdates
+
+			if tt.inKong == "" {
+				delete(service.files, "content/guides/guide.md")
+			} else {
+				service.files["content/guides/guide.md"] = tt.inKong
+			}
+			service.calls = nil
+			p.checkDrift(context.Background())
+
+			if fetched := len(service.calls) > 0; fetched != tt.wantFetched {
+				t.Errorf("calls = %v, want the file fetched %t", service.calls, tt.wantFetched)
+			}
+			status, _ := p.ObjectStatus(obj)
+			if status.Drifted != tt.wantDrifted {
+				t.Errorf("ObjectStatus().Drifted = %t, want %t", status.Drifted, tt.wantDrifted)
+			}
+			if notified := len(p.statusUpdates) > 0; notified != tt.wantDrifted {
+				t.Errorf("status update notified %t, want %t", notified, tt.wantDrifted)
+			}
+			if status.Pending != tt.wantApplied {
+				t.Fatalf("ObjectStatus().Pending = %t, want the file applied again %t", status.Pending, tt.wantApplied)
+			}
+			if !tt.wantApplied {
+				return
+			}
+
+			// the corrected file clears the drift
+			processQueued(t, p)
+			if contents := service.files["content/guides/guide.md"]; contents != published {
+				t.Errorf("contents = %q once corrected, want %q", contents, published)
+			}
+			if status, _ := p.ObjectStatus(obj); status.Drifted || status.Pending {
+				t.Errorf("ObjectStatus() = %+v once corrected, want the file in sync", status)
+			}
+		})
+	}
+}
+
+func TestCheckDriftSkipsPendingObjects(t *testing.T) {
+	service := newFakeFileService()
+	p := newTestProxy(t, service)
+	p.driftPolicy = DriftPolicyCorrect
+	if err := p.UpdateObject(testContentFile("guide", 1, "# Guide")); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+	if err := p.UpdateObject(testContentFile("guide", 2, "# Updated guide")); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+
+	// the queued operation overwrites the file anyway
+	service.calls = nil
+	p.checkDrift(context.Background())
+	if len(service.calls) > 0 {
+		t.Errorf("calls = %v, want objects with a pending operation skipped", service.calls)
+	}
+}
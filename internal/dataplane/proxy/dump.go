@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kong-portal-controller/internal/dataplane/configuration"
+	services "kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/util"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// -----------------------------------------------------------------------------
+// Config Dumps - Private Methods
+// -----------------------------------------------------------------------------
+
+// dumpConfig notifies the diagnostics server that the files changed, when config dumps are enabled.
+// The snapshot of the desired, applied and failed files is only built when a dump is requested, and
+// an update is dropped rather than blocking the workers when the diagnostics server lags behind.
+func (p *CachedProxyResolver) dumpConfig() {
+	if p.kongConfig.ConfigDone == nil {
+		return
+	}
+
+	update := &configuration.KongConfigUpdate{
+		Timestamp: time.Now(),
+		Snapshot:  p.configSnapshot,
+		Live: func(ctx context.Context) ([]*services.File, error) {
+			return p.service.ListAll(ctx, "")
+		},
+	}
+
+	select {
+	case p.kongConfig.ConfigDone <- update:
+	default:
+		p.logger.V(util.DebugLevel).Info("Diagnostics server is lagging behind, dropping config dump")
+	}
+}
+
+// configSnapshot provides the files rendered from the desired objects, the files last applied to Kong
+// and the last failures.
+func (p *CachedProxyResolver) configSnapshot() *configuration.ConfigSnapshot {
+	// the lists are dumped empty rather than null when the proxy has no files
+	snapshot := &configuration.ConfigSnapshot{
+		Desired: []configuration.FileDump{},
+		Applied: []configuration.FileDump{},
+		Failed:  []configuration.FailureDump{},
+	}
+
+	// the desired objects are the ones in the cache, superseded by the pending operations
+	desired := make(map[string]*developer.KongFile)
+	for _, item := range p.store.KongFiles.List() {
+		if obj, ok := item.(*developer.KongFile); ok {
+			desired[client.ObjectKeyFromObject(obj).String()] = obj
+		}
+	}
+
+	p.statusesLock.RLock()
+	for key, op := range p.pending {
+		if op.delete {
+			delete(desired, key)
+		} else {
+			desired[key] = op.object
+		}
+	}
+	for key, status := range p.statuses {
+		if status.File != nil && status.File.Path != nil && !status.Deleted {
+			snapshot.Applied = append(snapshot.Applied, configuration.FileDump{
+				Object:   key,
+				Path:     *status.File.Path,
+				Checksum: status.ContentsChecksum,
+			})
+		}
+		if status.Err != nil {
+			snapshot.Failed = append(snapshot.Failed, configuration.FailureDump{
+				Object:    key,
+				Delete:    status.Deleting,
+				Error:     status.Err.Error(),
+				Permanent: services.IsPermanent(status.Err),
+			})
+		}
+	}
+	p.statusesLock.RUnlock()
+
+	for key, obj := range desired {
+		file, err := Build(obj)
+		if err != nil {
+			continue
+		}
+		snapshot.Desired = append(snapshot.Desired, configuration.FileDump{
+			Object:   key,
+			Kind:     string(obj.Spec.Kind),
+			Path:     *file.Path,
+			Checksum: Checksum(*file.Contents),
+		})
+	}
+	sort.Slice(snapshot.Desired, func(i, j int) bool { return snapshot.Desired[i].Object < snapshot.Desired[j].Object })
+	sort.Slice(snapshot.Applied, func(i, j int) bool { return snapshot.Applied[i].Object < snapshot.Applied[j].Object })
+	sort.Slice(snapshot.Failed, func(i, j int) bool { return snapshot.Failed[i].Object < snapshot.Failed[j].Object })
+	return snapshot
+}
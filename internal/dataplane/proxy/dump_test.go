@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"kong-portal-controller/internal/dataplane/configuration"
+)
+
+func TestStartDumpsConfig(t *testing.T) {
+	p := newTestProxy(t, newFakeFileService())
+	p.kongConfig.ConfigDone = make(chan *configuration.KongConfigUpdate, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+
+	// the files are dumped once the proxy is started, even before a file is applied
+	var update *configuration.KongConfigUpdate
+	select {
+	case update = <-p.kongConfig.ConfigDone:
+	default:
+		t.Fatalf("Start() dumped no config")
+	}
+	snapshot := update.Snapshot()
+	if snapshot.Desired == nil || snapshot.Applied == nil || snapshot.Failed == nil {
+		t.Errorf("Snapshot() = %+v, want empty lists", snapshot)
+	}
+	if len(snapshot.Desired)+len(snapshot.Applied)+len(snapshot.Failed) > 0 {
+		t.Errorf("Snapshot() = %+v, want no files", snapshot)
+	}
+}
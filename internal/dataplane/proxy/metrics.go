@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// -----------------------------------------------------------------------------
+// Metrics - Private Methods
+// -----------------------------------------------------------------------------
+
+// updateInventoryMetrics computes the gauges describing the files managed by the proxy.
+func (p *CachedProxyResolver) updateInventoryMetrics() {
+	managed := map[string]float64{
+		string(developer.CONTENT):       0,
+		string(developer.SPECIFICATION): 0,
+		string(developer.ASSET):         0,
+	}
+	var drifted, failed, published float64
+
+	p.statusesLock.RLock()
+	// the cache only holds the objects whose file is published in Kong
+	for _, item := range p.store.KongFiles.List() {
+		obj, ok := item.(*developer.KongFile)
+		if !ok {
+			continue
+		}
+		managed[string(obj.Spec.Kind)]++
+		published += float64(p.statuses[client.ObjectKeyFromObject(obj).String()].Size)
+	}
+	for _, status := range p.statuses {
+		if status.Drifted {
+			drifted++
+		}
+		if status.Err != nil {
+			failed++
+		}
+	}
+	p.statusesLock.RUnlock()
+
+	for kind, count := range managed {
+		p.promMetrics.ManagedFiles.WithLabelValues(kind).Set(count)
+	}
+	p.promMetrics.DriftedFiles.Set(drifted)
+	p.promMetrics.FailedFiles.Set(failed)
+	p.promMetrics.PublishedBytes.Set(published)
+}
@@ -1,8 +1,14 @@
 package proxy
 
 import (
+	"time"
+
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	services "kong-portal-controller/internal/kong"
+	developer "kong-portal-controller/pkg/apis/v1"
 )
 
 // -----------------------------------------------------------------------------
@@ -18,7 +24,8 @@ const (
 	DefaultProxyTimeoutSeconds float32 = 10.0
 
 	// DefaultSyncSeconds indicates the time.Duration (minimum) that will occur between
-	// updates to the Kong Proxy Admin API when using the NewProxy() constructor.
+	// the submission of a change and its application to the Kong Proxy Admin API when
+	// using the NewProxy() constructor, changes submitted meanwhile are coalesced.
 	// this 1s default was based on local testing wherein it appeared sub-second updates
 	// to the Admin API could be problematic (or at least operate differently) based on
 	// which storage backend was in use (i.e. "dbless", "postgres"). This is a workaround
@@ -26,12 +33,55 @@ const (
 	//
 	// See Also: https://github.com/Kong/kong-portal-controller/issues/1398
 	DefaultSyncSeconds float32 = 3.0
+
+	// DefaultResyncPeriod indicates the time.Duration between two comparisons of the files
+	// in Kong with the objects, when reverse sync is enabled.
+	DefaultResyncPeriod = 5 * time.Minute
 )
 
 // -----------------------------------------------------------------------------
 // Proxy - Public Types
 // -----------------------------------------------------------------------------
 
+// FileStatus is the state of a file as last applied to the Kong Admin API.
+type FileStatus struct {
+	// File is the file as returned by the Kong Admin API, without its contents.
+	File *services.File
+
+	// ContentsChecksum is the checksum of the contents last applied to the Kong Admin API.
+	ContentsChecksum string
+
+	// Size is the size of the contents last applied to the Kong Admin API, in bytes.
+	Size int
+
+	// PreviousPaths are the paths the file moved from, until their removal from the Kong Admin API succeeds.
+	PreviousPaths []string
+
+	// Workspace is the Kong workspace the file is published in.
+	Workspace string
+
+	// SyncedAt is the time the file was last written to the Kong Admin API.
+	SyncedAt time.Time
+
+	// Drifted indicates the file in Kong differs from the object since the last drift detection.
+	Drifted bool
+
+	// Generation is the generation of the object last submitted to the proxy.
+	Generation int64
+
+	// Pending indicates an operation submitted for the object has not been applied yet.
+	Pending bool
+
+	// Deleting indicates the operation last submitted for the object is a delete.
+	Deleting bool
+
+	// Deleted indicates the file has been removed from the Kong Admin API.
+	Deleted bool
+
+	// Err is the error returned by the Kong Admin API for the last attempt, nil once an attempt succeeded.
+	Err error
+}
+
 // Proxy represents the Kong Proxy from the perspective of Kubernetes allowing
 // callers to update and remove Kubernetes objects in the backend proxy without
 // having to understand or be aware of Kong DSLs or how types are converted between
@@ -55,6 +105,21 @@ type Proxy interface {
 	// ObjectExists indicates if any version of the provided object is already present in the proxy.
 	ObjectExistsInCache(obj client.Object) (client.Object, bool, error)
 
+	// ObjectStatus provides the state of the provided object as last applied to the Kong Admin API.
+	ObjectStatus(obj client.Object) (FileStatus, bool)
+
+	// ForgetObject drops the state and the cache entry kept for the provided object, without removing its file
+	// from the Kong Admin API, unless an operation is still pending for it.
+	ForgetObject(obj client.Object)
+
+	// KnownPaths provides the paths of the files applied to the Kong Admin API for the objects known by the proxy,
+	// as well as the paths of the files about to be applied by their pending operations.
+	KnownPaths() map[string]struct{}
+
+	// StatusUpdates provides the objects whose FileStatus changed outside of a reconciliation,
+	// e.g. when a queued operation was applied or a drift was detected, so that controllers can report it.
+	StatusUpdates() <-chan event.GenericEvent
+
 	// IsReady returns true if the proxy is considered ready.
 	// A ready proxy has developer available and can handle traffic.
 	IsReady() bool
@@ -63,3 +128,17 @@ type Proxy interface {
 
 	manager.LeaderElectionRunnable
 }
+
+// -----------------------------------------------------------------------------
+// Proxy - Public Functions
+// -----------------------------------------------------------------------------
+
+// PublishedPath provides the path of the file a KongFile publishes in Kong: the one last applied by the proxy,
+// or the one recorded in its status when the proxy does not know it yet, e.g. after a restart. Moves may be
+// submitted before the status of the KongFile recorded the previous path.
+func PublishedPath(p Proxy, obj *developer.KongFile) string {
+	if status, known := p.ObjectStatus(obj); known && status.File != nil && status.File.Path != nil {
+		return *status.File.Path
+	}
+	return obj.Status.Path
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	services "kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/metrics"
+	"kong-portal-controller/internal/util"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// -----------------------------------------------------------------------------
+// Work Queue - Private Types
+// -----------------------------------------------------------------------------
+
+// operation is a change waiting to be applied to the Kong Admin API for an object.
+// Only the latest operation submitted for an object is kept, so rapid updates are coalesced.
+type operation struct {
+	object *developer.KongFile
+	delete bool
+}
+
+// jitteredRateLimiter spreads the delays of another rate limiter between their half and their full value,
+// so that the operations failing together, e.g. while Kong is unavailable, are not retried in sync.
+type jitteredRateLimiter struct {
+	workqueue.RateLimiter
+}
+
+// When provides the jittered delay before the item is retried.
+func (r jitteredRateLimiter) When(item interface{}) time.Duration {
+	half := r.RateLimiter.When(item) / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// -----------------------------------------------------------------------------
+// Work Queue - Private Methods
+// -----------------------------------------------------------------------------
+
+// submit records the operation as the latest one for its object and queues the object after the stagger delay.
+func (p *CachedProxyResolver) submit(op operation) {
+	key := client.ObjectKeyFromObject(op.object).String()
+
+	p.statusesLock.Lock()
+	status := p.statuses[key]
+	status.Generation = op.object.Generation
+	status.Pending = true
+	status.Deleting = op.delete
+	status.Deleted = false
+	p.statuses[key] = status
+	p.pending[key] = op
+	p.statusesLock.Unlock()
+
+	p.queue.AddAfter(key, p.stagger)
+}
+
+// runWorkers applies the queued operations with at most kongConfig.Concurrency concurrent calls
+// to the Kong Admin API, until the context is done.
+func (p *CachedProxyResolver) runWorkers(ctx context.Context) {
+	workers := p.kongConfig.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, p.processNext, time.Second)
+	}
+
+	<-ctx.Done()
+	p.queue.ShutDown()
+}
+
+// processNext applies the latest operation of the next queued object.
+func (p *CachedProxyResolver) processNext(ctx context.Context) {
+	for {
+		item, shutdown := p.queue.Get()
+		if shutdown {
+			return
+		}
+		p.process(ctx, item.(string))
+		p.queue.Done(item)
+	}
+}
+
+// process applies the latest operation of an object and records its outcome. Failed operations are
+// retried with a rate limited backoff unless a newer operation was submitted meanwhile, or the failure
+// is permanent: the operation is then dropped until the object changes.
+func (p *CachedProxyResolver) process(ctx context.Context, key string) {
+	p.statusesLock.Lock()
+	op, ok := p.pending[key]
+	delete(p.pending, key)
+	p.statusesLock.Unlock()
+	if !ok {
+		return
+	}
+
+	var expected, file *services.File
+	var checksum string
+	var previous []string
+	var err error
+	if op.delete {
+		err = p.deleteFile(ctx, op.object)
+	} else {
+		expected, err = p.translate(op.object)
+		if err == nil {
+			file, checksum, previous, err = p.applyFile(ctx, op.object, expected)
+		}
+	}
+
+	p.statusesLock.Lock()
+	status := p.statuses[key]
+	_, status.Pending = p.pending[key]
+	// the file written to Kong is recorded even when its removal from its previous path failed
+	if file != nil {
+		status.File = file
+		status.ContentsChecksum = checksum
+		status.Size = len(*expected.Contents)
+		status.Workspace = p.kongConfig.Client.Workspace()
+		status.SyncedAt = time.Now()
+	}
+	// the previous paths are kept until the file is written and removed from them
+	if !op.delete && (err == nil || len(previous) > 0) {
+		status.PreviousPaths = previous
+	}
+	// once the file is written, the removals left are retried even if Kong refused them
+	retried := err != nil && (!services.IsPermanent(err) || len(previous) > 0)
+	switch {
+	case err != nil:
+		status.Err = err
+		if !status.Pending && retried {
+			// retry the failed operation, unless it has been superseded or would fail again
+			p.pending[key] = op
+			status.Pending = true
+			p.queue.AddRateLimited(key)
+		}
+	case op.delete:
+		status = FileStatus{Generation: status.Generation, Pending: status.Pending, Deleting: status.Deleting, Deleted: true}
+	default:
+		status.Err = nil
+		status.Drifted = false
+	}
+	p.statuses[key] = status
+	p.statusesLock.Unlock()
+
+	switch {
+	case err != nil && !retried:
+		p.logger.Error(err, "Kong rejected the file, it won't be retried until the object changes", "object", key, "delete", op.delete)
+		if !status.Pending {
+			p.queue.Forget(key)
+		}
+	case err != nil:
+		p.logger.Error(err, "Failed to apply file to Kong, retrying ...", "object", key, "delete", op.delete)
+	default:
+		// the cache only holds objects whose changes have been confirmed by Kong
+		if op.delete {
+			p.store.Delete(op.object)
+		} else {
+			p.store.Update(op.object)
+		}
+		if !status.Pending {
+			p.queue.Forget(key)
+		}
+		p.configAppliedMutex.Lock()
+		p.configApplied = true
+		p.configAppliedMutex.Unlock()
+		p.logger.V(util.DebugLevel).Info("File applied to Kong", "object", key, "delete", op.delete)
+	}
+
+	p.updateInventoryMetrics()
+	p.dumpConfig()
+	p.notify(ctx, op.object)
+}
+
+// translate builds the file of an object, refusing objects which cannot be published as a permanent failure.
+func (p *CachedProxyResolver) translate(obj *developer.KongFile) (*services.File, error) {
+	file, err := Build(obj)
+	if err == nil {
+		err = p.sizeLimits.Check(&obj.Spec, *file.Contents)
+	}
+	if err != nil {
+		p.promMetrics.TranslationCount.WithLabelValues(metrics.SuccessFalse, string(obj.Spec.Kind)).Inc()
+		return nil, services.Permanent(err)
+	}
+	p.promMetrics.TranslationCount.WithLabelValues(metrics.SuccessTrue, string(obj.Spec.Kind)).Inc()
+	return file, nil
+}
+
+// applyFile writes the file of an object to Kong and removes it from its previous paths when it moved.
+// The returned file is nil when the contents were unchanged and no call was made to the Kong Admin API.
+// The returned paths are the previous ones the file is still published at, when it was written but their removal failed.
+func (p *CachedProxyResolver) applyFile(ctx context.Context, obj *developer.KongFile, expected *services.File) (*services.File, string, []string, error) {
+	// the removals which failed in previous attempts are retried as well
+	status, _ := p.ObjectStatus(obj)
+	previous := append([]string{PublishedPath(p, obj)}, status.PreviousPaths...)
+	file, checksum, err := p.apply(ctx, obj, expected)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// a change of kind, path or name moves the file, remove it from its previous locations
+	var remaining []string
+	var removalErr error
+	for i, path := range previous {
+		if path == "" || path == *expected.Path || containsString(previous[:i], path) {
+			continue
+		}
+		p.logger.Info("File moved, removing it from its previous path", "namespace", obj.Namespace, "name", obj.Name, "path", *expected.Path, "previous", path)
+		err := p.service.Delete(ctx, &services.File{Path: &previous[i]})
+		if err != nil && !services.IsNotFound(err) {
+			remaining = append(remaining, path)
+			removalErr = fmt.Errorf("failed to remove file from its previous path %q: %w", path, err)
+		}
+	}
+	return file, checksum, remaining, removalErr
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteFile removes the file of an object from Kong, a file which does not exist is considered deleted.
+func (p *CachedProxyResolver) deleteFile(ctx context.Context, obj *developer.KongFile) error {
+	// the path recorded at publish time survives restarts and spec changes
+	path := PublishedPath(p, obj)
+	if path == "" {
+		built, err := BuildPath(obj)
+		if err != nil {
+			// a file without a valid path cannot have been published
+			return nil
+		}
+		path = built
+	}
+	// the file is also removed from the previous paths it was left at by failed moves
+	status, _ := p.ObjectStatus(obj)
+	paths := append([]string{path}, status.PreviousPaths...)
+	for i := range paths {
+		err := p.service.Delete(ctx, &services.File{Path: &paths[i]})
+		if err != nil && !services.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
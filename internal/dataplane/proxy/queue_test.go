@@ -0,0 +1,403 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kong/go-kong/kong"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"kong-portal-controller/internal/dataplane/configuration"
+	services "kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/metrics"
+	"kong-portal-controller/internal/store"
+	developer "kong-portal-controller/pkg/apis/v1"
+)
+
+// testMetrics are shared by the proxies of the tests, so that the metrics are registered once.
+var testMetrics = metrics.NewCtrlFuncMetrics()
+
+// fakeFileService holds the files in memory and records the calls made to it. The calls fail with err while it is set,
+// onCall being run before each call.
+type fakeFileService struct {
+	services.AbstractFileService
+
+	files map[string]string
+	err   error
+
+	onCall func(method, path string)
+	calls  []string
+}
+
+func newFakeFileService() *fakeFileService {
+	return &fakeFileService{files: map[string]string{}}
+}
+
+func (s *fakeFileService) call(method string, file *services.File) error {
+	if s.onCall != nil {
+		s.onCall(method, *file.Path)
+	}
+	s.calls = append(s.calls, method+" "+*file.Path)
+	return s.err
+}
+
+func (s *fakeFileService) Get(_ context.Context, file *services.File) (*services.File, error) {
+	if err := s.call(http.MethodGet, file); err != nil {
+		return nil, err
+	}
+	contents, ok := s.files[*file.Path]
+	if !ok {
+		return nil, services.ErrNotFound{}
+	}
+	return &services.File{ID: kong.String("id"), Path: file.Path, Contents: kong.String(contents)}, nil
+}
+
+func (s *fakeFileService) Update(_ context.Context, file *services.File) (*services.File, error) {
+	if err := s.call(http.MethodPatch, file); err != nil {
+		return nil, err
+	}
+	s.files[*file.Path] = *file.Contents
+	return &services.File{ID: kong.String("id"), Path: file.Path, Contents: file.Contents}, nil
+}
+
+func (s *fakeFileService) Delete(_ context.Context, file *services.File) error {
+	if err := s.call(http.MethodDelete, file); err != nil {
+		return err
+	}
+	if _, ok := s.files[*file.Path]; !ok {
+		return services.ErrNotFound{}
+	}
+	delete(s.files, *file.Path)
+	return nil
+}
+
+// newTestProxy provides a proxy applying the files to the service, whose queue is processed by the test.
+func newTestProxy(t *testing.T, service services.AbstractFileService) *CachedProxyResolver {
+	t.Helper()
+	kongClient, err := kong.NewClient(kong.String("http://localhost:8001"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CachedProxyResolver{
+		kongConfig:    configuration.Kong{Client: kongClient, Concurrency: 1},
+		ctx:           context.Background(),
+		store:         store.NewCacheStores(logr.Discard()),
+		service:       service,
+		statuses:      make(map[string]FileStatus),
+		pending:       make(map[string]operation),
+		queue:         workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Second)),
+		statusUpdates: make(chan event.GenericEvent, statusUpdatesBufferDepth),
+		promMetrics:   testMetrics,
+		logger:        logr.Discard(),
+	}
+}
+
+// testContentFile provides a CONTENT KongFile published at content/guides/<name>.md.
+func testContentFile(name string, generation int64, content string) *developer.KongFile {
+	obj := &developer.KongFile{Spec: developer.KongFileSpec{
+		Kind:    developer.CONTENT,
+		Path:    "guides",
+		Name:    name + ".md",
+		Title:   "Guide",
+		Layout:  "page",
+		Content: content,
+	}}
+	obj.Namespace = "default"
+	obj.Name = name
+	obj.Generation = generation
+	return obj
+}
+
+// processQueued processes the object queued by the proxy, failing unless it is the only one.
+func processQueued(t *testing.T, p *CachedProxyResolver) {
+	t.Helper()
+	if p.queue.Len() != 1 {
+		t.Fatalf("queue holds %d objects, want one", p.queue.Len())
+	}
+	item, _ := p.queue.Get()
+	p.process(context.Background(), item.(string))
+	p.queue.Done(item)
+}
+
+func inStore(t *testing.T, p *CachedProxyResolver, obj client.Object) bool {
+	t.Helper()
+	_, exists, err := p.store.Get(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func TestProcessCoalescesOperations(t *testing.T) {
+	service := newFakeFileService()
+	p := newTestProxy(t, service)
+
+	for generation, content := range []string{"# First", "# Second", "# Third"} {
+		if err := p.UpdateObject(testContentFile("guide", int64(generation+1), content)); err != nil {
+			t.Fatalf("UpdateObject() unexpected error: %v", err)
+		}
+	}
+	processQueued(t, p)
+
+	if want := []string{"GET content/guides/guide.md", "PATCH content/guides/guide.md"}; !equalStrings(service.calls, want) {
+		t.Errorf("calls = %v, want %v", service.calls, want)
+	}
+	if contents := service.files["content/guides/guide.md"]; contents != "---\ntitle: Guide\nlayout: page\n---\n# Third" {
+		t.Errorf("contents = %q, want the latest generation", contents)
+	}
+	status, _ := p.ObjectStatus(testContentFile("guide", 3, ""))
+	if status.Pending || status.Err != nil || status.Generation != 3 {
+		t.Errorf("ObjectStatus() = %+v, want generation 3 applied", status)
+	}
+	if p.queue.Len() != 0 {
+		t.Errorf("queue holds %d objects once applied, want none", p.queue.Len())
+	}
+}
+
+func TestProcessRetriesFailures(t *testing.T) {
+	service := newFakeFileService()
+	p := newTestProxy(t, service)
+	obj := testContentFile("guide", 1, "# Guide")
+	key := client.ObjectKeyFromObject(obj).String()
+
+	service.err = kong.NewAPIError(http.StatusServiceUnavailable, "unavailable")
+	if err := p.UpdateObject(obj); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+	status, _ := p.ObjectStatus(obj)
+	if !status.Pending || status.Err == nil {
+		t.Errorf("ObjectStatus() = %+v, want the failed operation pending", status)
+	}
+	if requeues := p.queue.NumRequeues(key); requeues != 1 {
+		t.Errorf("NumRequeues() = %d, want the failed operation retried with a backoff", requeues)
+	}
+
+	service.err = nil
+	time.Sleep(10 * time.Millisecond)
+	processQueued(t, p)
+	status, _ = p.ObjectStatus(obj)
+	if status.Pending || status.Err != nil || status.File == nil {
+		t.Errorf("ObjectStatus() = %+v, want the retried operation applied", status)
+	}
+	if requeues := p.queue.NumRequeues(key); requeues != 0 {
+		t.Errorf("NumRequeues() = %d once applied, want the backoff reset", requeues)
+	}
+}
+
+func TestProcessSupersededRetry(t *testing.T) {
+	service := newFakeFileService()
+	p := newTestProxy(t, service)
+	key := client.ObjectKeyFromObject(testContentFile("guide", 1, "")).String()
+
+	// a newer generation is submitted while the failing one is applied
+	service.err = kong.NewAPIError(http.StatusServiceUnavailable, "unavailable")
+	service.onCall = func(_, _ string) {
+		service.onCall = nil
+		if err := p.UpdateObject(testContentFile("guide", 2, "# Second")); err != nil {
+			t.Errorf("UpdateObject() unexpected error: %v", err)
+		}
+	}
+	if err := p.UpdateObject(testContentFile("guide", 1, "# First")); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+	if requeues := p.queue.NumRequeues(key); requeues != 0 {
+		t.Errorf("NumRequeues() = %d, want the superseded operation not retried", requeues)
+	}
+
+	service.err = nil
+	processQueued(t, p)
+	if contents := service.files["content/guides/guide.md"]; contents != "---\ntitle: Guide\nlayout: page\n---\n# Second" {
+		t.Errorf("contents = %q, want the newer generation", contents)
+	}
+	status, _ := p.ObjectStatus(testContentFile("guide", 2, ""))
+	if status.Pending || status.Err != nil || status.Generation != 2 {
+		t.Errorf("ObjectStatus() = %+v, want generation 2 applied", status)
+	}
+}
+
+func TestProcessDropsPermanentFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		err        error
+		sizeLimits SizeLimits
+		wantCalls  int
+	}{
+		{
+			name:      "rejected by Kong",
+			err:       services.Permanent(kong.NewAPIError(http.StatusBadRequest, "schema violation")),
+			wantCalls: 1,
+		},
+		{
+			name:       "above the size limit",
+			sizeLimits: SizeLimits{developer.CONTENT: 8},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newFakeFileService()
+			service.err = tt.err
+			p := newTestProxy(t, service)
+			p.sizeLimits = tt.sizeLimits
+			obj := testContentFile("guide", 1, "# Guide")
+			key := client.ObjectKeyFromObject(obj).String()
+
+			if err := p.UpdateObject(obj); err != nil {
+				t.Fatalf("UpdateObject() unexpected error: %v", err)
+			}
+			processQueued(t, p)
+
+			status, _ := p.ObjectStatus(obj)
+			if status.Pending || !services.IsPermanent(status.Err) {
+				t.Errorf("ObjectStatus() = %+v, want a permanent failure which is not pending", status)
+			}
+			if requeues := p.queue.NumRequeues(key); requeues != 0 || p.queue.Len() != 0 {
+				t.Errorf("queue holds %d objects with %d requeues, want the operation dropped", p.queue.Len(), requeues)
+			}
+			if len(service.calls) != tt.wantCalls {
+				t.Errorf("calls = %v, want %d", service.calls, tt.wantCalls)
+			}
+			if inStore(t, p, obj) {
+				t.Errorf("object stored, want only objects confirmed by Kong")
+			}
+		})
+	}
+}
+
+func TestProcessRetriesRemovalOfMovedFile(t *testing.T) {
+	service := newFakeFileService()
+	p := newTestProxy(t, service)
+	if err := p.UpdateObject(testContentFile("guide", 1, "# Guide")); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+
+	// Kong refuses the removal of the file from its previous path once it is written to the new one
+	service.onCall = func(method, _ string) {
+		service.err = nil
+		if method == http.MethodDelete {
+			service.err = services.Permanent(kong.NewAPIError(http.StatusConflict, "conflict"))
+		}
+	}
+	moved := testContentFile("guide", 2, "# Guide")
+	moved.Spec.Path = "docs"
+	key := client.ObjectKeyFromObject(moved).String()
+	if err := p.UpdateObject(moved); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+
+	status, _ := p.ObjectStatus(moved)
+	if status.File == nil || *status.File.Path != "content/docs/guide.md" {
+		t.Errorf("ObjectStatus() = %+v, want the file written to its new path recorded", status)
+	}
+	if !equalStrings(status.PreviousPaths, []string{"content/guides/guide.md"}) || !status.Pending || status.Err == nil {
+		t.Errorf("ObjectStatus() = %+v, want the removal from the previous path pending", status)
+	}
+	if requeues := p.queue.NumRequeues(key); requeues != 1 {
+		t.Errorf("NumRequeues() = %d, want the removal retried with a backoff", requeues)
+	}
+
+	service.onCall, service.err, service.calls = nil, nil, nil
+	time.Sleep(10 * time.Millisecond)
+	processQueued(t, p)
+	if want := []string{"DELETE content/guides/guide.md"}; !equalStrings(service.calls, want) {
+		t.Errorf("calls = %v, want only the removal retried", service.calls)
+	}
+	if _, ok := service.files["content/guides/guide.md"]; ok {
+		t.Errorf("file left at its previous path")
+	}
+	status, _ = p.ObjectStatus(moved)
+	if len(status.PreviousPaths) > 0 || status.Pending || status.Err != nil {
+		t.Errorf("ObjectStatus() = %+v, want the move applied", status)
+	}
+	if _, ok := service.files["content/docs/guide.md"]; !ok {
+		t.Errorf("file missing from its new path")
+	}
+}
+
+func TestProcessStoresConfirmedObjects(t *testing.T) {
+	service := newFakeFileService()
+	p := newTestProxy(t, service)
+	obj := testContentFile("guide", 1, "# Guide")
+
+	// the object is stored once Kong confirmed the file
+	service.onCall = func(method, _ string) {
+		if method == http.MethodPatch && inStore(t, p, obj) {
+			t.Errorf("object stored before Kong confirmed the file")
+		}
+	}
+	service.err = kong.NewAPIError(http.StatusServiceUnavailable, "unavailable")
+	if err := p.UpdateObject(obj); err != nil {
+		t.Fatalf("UpdateObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+	if inStore(t, p, obj) {
+		t.Errorf("object stored after a failure, want only objects confirmed by Kong")
+	}
+
+	service.err = nil
+	time.Sleep(10 * time.Millisecond)
+	processQueued(t, p)
+	if !inStore(t, p, obj) {
+		t.Errorf("object not stored once Kong confirmed the file")
+	}
+
+	// the object is kept until Kong confirmed the removal
+	service.onCall = func(method, _ string) {
+		if method == http.MethodDelete && !inStore(t, p, obj) {
+			t.Errorf("object removed from the store before Kong confirmed the removal")
+		}
+	}
+	service.err = kong.NewAPIError(http.StatusServiceUnavailable, "unavailable")
+	if err := p.DeleteObject(obj); err != nil {
+		t.Fatalf("DeleteObject() unexpected error: %v", err)
+	}
+	processQueued(t, p)
+	if !inStore(t, p, obj) {
+		t.Errorf("object removed from the store after a failure")
+	}
+
+	service.err = nil
+	time.Sleep(10 * time.Millisecond)
+	processQueued(t, p)
+	if inStore(t, p, obj) {
+		t.Errorf("object still stored once Kong confirmed the removal")
+	}
+	if status, _ := p.ObjectStatus(obj); !status.Deleted {
+		t.Errorf("ObjectStatus() = %+v, want the file deleted", status)
+	}
+}
+
+func TestJitteredRateLimiter(t *testing.T) {
+	limiter := jitteredRateLimiter{workqueue.NewItemExponentialFailureRateLimiter(100*time.Millisecond, time.Second)}
+	for _, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second} {
+		if delay := limiter.When("default/guide"); delay < want/2 || delay > want {
+			t.Errorf("When() = %s, want between %s and %s", delay, want/2, want)
+		}
+	}
+	if requeues := limiter.NumRequeues("default/guide"); requeues != 5 {
+		t.Errorf("NumRequeues() = %d, want 5", requeues)
+	}
+	limiter.Forget("default/guide")
+	if delay := limiter.When("default/guide"); delay > 100*time.Millisecond {
+		t.Errorf("When() = %s once forgotten, want the backoff reset", delay)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
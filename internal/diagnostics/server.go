@@ -10,8 +10,9 @@ import (
 	"sync"
 
 	"github.com/go-logr/logr"
-	"github.com/kong/deck/file"
 
+	"kong-portal-controller/internal/dataplane/configuration"
+	"kong-portal-controller/internal/dataplane/proxy"
 	"kong-portal-controller/internal/util"
 )
 
@@ -20,8 +21,31 @@ type Server struct {
 	Logger           logr.Logger
 	ProfilingEnabled bool
 	ConfigLock       *sync.RWMutex
+
+	// ConfigDumps receives the configuration dumps of the proxy, the dump endpoints are disabled when nil.
+	ConfigDumps <-chan *configuration.KongConfigUpdate
+
+	// lastConfig is the last configuration dump received, guarded by ConfigLock
+	lastConfig *configuration.KongConfigUpdate
+}
+
+// FileDiff is a difference between a file rendered from an object and the file currently in Kong.
+type FileDiff struct {
+	Object          string `json:"object"`
+	Path            string `json:"path"`
+	Status          string `json:"status"`
+	DesiredChecksum string `json:"desiredChecksum"`
+	LiveChecksum    string `json:"liveChecksum,omitempty"`
 }
 
+const (
+	// FileDiffMissing indicates the file does not exist in Kong.
+	FileDiffMissing = "missing"
+
+	// FileDiffChanged indicates the contents of the file in Kong differ from the rendered contents.
+	FileDiffChanged = "changed"
+)
+
 // Listen starts up the HTTP server and blocks until ctx expires.
 func (s *Server) Listen(ctx context.Context, port int) error {
 
@@ -29,12 +53,14 @@ func (s *Server) Listen(ctx context.Context, port int) error {
 	if s.ProfilingEnabled {
 		installProfilingHandlers(mux)
 	}
+	if s.ConfigDumps != nil {
+		s.installDumpHandlers(mux)
+		go s.receiveConfig(ctx)
+	}
 
 	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
 	errChan := make(chan error)
 
-	go s.receiveConfig(ctx)
-
 	go func() {
 		err := httpServer.ListenAndServe()
 		if err != nil {
@@ -68,6 +94,10 @@ func (s *Server) receiveConfig(ctx context.Context) {
 			}
 			s.Logger.V(util.InfoLevel).Info("shutting down diagnostic config collection: context completed")
 			return
+		case update := <-s.ConfigDumps:
+			s.ConfigLock.Lock()
+			s.lastConfig = update
+			s.ConfigLock.Unlock()
 		}
 	}
 }
@@ -89,6 +119,16 @@ func installProfilingHandlers(mux *http.ServeMux) {
 
 // installDumpHandlers adds the config dump webservice to the given mux.
 func (s *Server) installDumpHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/config/desired", s.dumpConfig(func(snapshot *configuration.ConfigSnapshot) interface{} {
+		return snapshot.Desired
+	}))
+	mux.HandleFunc("/debug/config/applied", s.dumpConfig(func(snapshot *configuration.ConfigSnapshot) interface{} {
+		return snapshot.Applied
+	}))
+	mux.HandleFunc("/debug/config/failed", s.dumpConfig(func(snapshot *configuration.ConfigSnapshot) interface{} {
+		return snapshot.Failed
+	}))
+	mux.HandleFunc("/debug/config/diff", s.diffConfig)
 }
 
 // redirectTo redirects request to a certain destination.
@@ -98,13 +138,64 @@ func redirectTo(to string) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
-func (s *Server) lastConfig(config *file.Content) func(rw http.ResponseWriter, req *http.Request) {
+// dumpConfig serves the part of the configuration snapshot provided by the selector.
+func (s *Server) dumpConfig(selector func(snapshot *configuration.ConfigSnapshot) interface{}) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
-		rw.Header().Set("Content-Type", "application/json")
 		s.ConfigLock.RLock()
-		if err := json.NewEncoder(rw).Encode(*config); err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
-		}
+		update := s.lastConfig
 		s.ConfigLock.RUnlock()
+		if update == nil {
+			http.Error(rw, "the proxy has not started yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(rw, selector(update.Snapshot()))
+	}
+}
+
+// diffConfig serves the differences between the files rendered from the desired objects
+// and the files currently in Kong.
+func (s *Server) diffConfig(rw http.ResponseWriter, req *http.Request) {
+	s.ConfigLock.RLock()
+	update := s.lastConfig
+	s.ConfigLock.RUnlock()
+	if update == nil {
+		http.Error(rw, "the proxy has not started yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	files, err := update.Live(req.Context())
+	if err != nil {
+		s.Logger.Error(err, "could not fetch files from Kong")
+		http.Error(rw, fmt.Sprintf("could not fetch files from Kong: %v", err), http.StatusBadGateway)
+		return
+	}
+	live := make(map[string]string, len(files))
+	for _, file := range files {
+		if file.Path != nil && file.Contents != nil {
+			live[*file.Path] = proxy.Checksum(*file.Contents)
+		}
+	}
+
+	diffs := []FileDiff{}
+	for _, desired := range update.Snapshot().Desired {
+		checksum, ok := live[desired.Path]
+		switch {
+		case !ok:
+			diffs = append(diffs, FileDiff{Object: desired.Object, Path: desired.Path, Status: FileDiffMissing, DesiredChecksum: desired.Checksum})
+		case checksum != desired.Checksum:
+			diffs = append(diffs, FileDiff{Object: desired.Object, Path: desired.Path, Status: FileDiffChanged, DesiredChecksum: desired.Checksum, LiveChecksum: checksum})
+		}
+	}
+	writeJSON(rw, diffs)
+}
+
+// writeJSON writes the value as the JSON body of the response.
+func writeJSON(rw http.ResponseWriter, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write(body)
 }
@@ -0,0 +1,161 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kong/go-kong/kong"
+
+	"kong-portal-controller/internal/dataplane/configuration"
+	"kong-portal-controller/internal/dataplane/proxy"
+	services "kong-portal-controller/internal/kong"
+)
+
+func serve(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	s.installDumpHandlers(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestDumpHandlers(t *testing.T) {
+	guide := configuration.FileDump{Object: "default/guide", Kind: "CONTENT", Path: "content/guides/guide.md", Checksum: proxy.Checksum("# Guide")}
+	live := func(files ...*services.File) func(context.Context) ([]*services.File, error) {
+		return func(context.Context) ([]*services.File, error) {
+			return files, nil
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		update   *configuration.KongConfigUpdate
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "desired before the proxy started", path: "/debug/config/desired", wantCode: http.StatusServiceUnavailable},
+		{name: "diff before the proxy started", path: "/debug/config/diff", wantCode: http.StatusServiceUnavailable},
+		{
+			name:     "desired without files",
+			update:   &configuration.KongConfigUpdate{Snapshot: emptySnapshot},
+			path:     "/debug/config/desired",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			name:     "applied without files",
+			update:   &configuration.KongConfigUpdate{Snapshot: emptySnapshot},
+			path:     "/debug/config/applied",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			name:     "failed without failures",
+			update:   &configuration.KongConfigUpdate{Snapshot: emptySnapshot},
+			path:     "/debug/config/failed",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			name:     "diff without files",
+			update:   &configuration.KongConfigUpdate{Snapshot: emptySnapshot, Live: live()},
+			path:     "/debug/config/diff",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			name: "desired",
+			update: &configuration.KongConfigUpdate{Snapshot: func() *configuration.ConfigSnapshot {
+				snapshot := emptySnapshot()
+				snapshot.Desired = append(snapshot.Desired, guide)
+				return snapshot
+			}},
+			path:     "/debug/config/desired",
+			wantCode: http.StatusOK,
+			wantBody: `[{"object":"default/guide","kind":"CONTENT","path":"content/guides/guide.md","checksum":"` + guide.Checksum + `"}]`,
+		},
+		{
+			name: "diff",
+			update: &configuration.KongConfigUpdate{
+				Snapshot: func() *configuration.ConfigSnapshot {
+					snapshot := emptySnapshot()
+					snapshot.Desired = append(snapshot.Desired, guide)
+					return snapshot
+				},
+				Live: live(&services.File{Path: kong.String(guide.Path), Contents: kong.String("# Changed")}),
+			},
+			path:     "/debug/config/diff",
+			wantCode: http.StatusOK,
+			wantBody: `[{"object":"default/guide","path":"content/guides/guide.md","status":"changed","desiredChecksum":"` +
+				guide.Checksum + `","liveChecksum":"` + proxy.Checksum("# Changed") + `"}]`,
+		},
+		{
+			name: "diff with Kong unreachable",
+			update: &configuration.KongConfigUpdate{Snapshot: emptySnapshot, Live: func(context.Context) ([]*services.File, error) {
+				return nil, errors.New("connection refused")
+			}},
+			path:     "/debug/config/diff",
+			wantCode: http.StatusBadGateway,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Logger: logr.Discard(), ConfigLock: &sync.RWMutex{}, lastConfig: tt.update}
+
+			recorder := serve(t, s, tt.path)
+			if recorder.Code != tt.wantCode {
+				t.Fatalf("GET %s = %d, want %d: %s", tt.path, recorder.Code, tt.wantCode, recorder.Body)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if body := strings.TrimSpace(recorder.Body.String()); body != tt.wantBody {
+				t.Errorf("GET %s = %s, want %s", tt.path, body, tt.wantBody)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("GET %s content type = %q, want JSON", tt.path, contentType)
+			}
+		})
+	}
+}
+
+// emptySnapshot is the snapshot of a proxy without files.
+func emptySnapshot() *configuration.ConfigSnapshot {
+	return &configuration.ConfigSnapshot{
+		Desired: []configuration.FileDump{},
+		Applied: []configuration.FileDump{},
+		Failed:  []configuration.FailureDump{},
+	}
+}
+
+func TestReceiveConfig(t *testing.T) {
+	dumps := make(chan *configuration.KongConfigUpdate)
+	s := &Server{Logger: logr.Discard(), ConfigLock: &sync.RWMutex{}, ConfigDumps: dumps}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.receiveConfig(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if recorder := serve(t, s, "/debug/config/desired"); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /debug/config/desired = %d before a dump, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+	// the second dump is received once the first one is stored
+	dumps <- &configuration.KongConfigUpdate{Snapshot: emptySnapshot}
+	dumps <- &configuration.KongConfigUpdate{Snapshot: emptySnapshot}
+	if recorder := serve(t, s, "/debug/config/desired"); recorder.Code != http.StatusOK {
+		t.Errorf("GET /debug/config/desired = %d once dumped, want %d", recorder.Code, http.StatusOK)
+	}
+}
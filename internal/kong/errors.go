@@ -0,0 +1,62 @@
+package kong
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kong/go-kong/kong"
+)
+
+// ErrNotFound error is returned when a File does not exist in Kong.
+// This type is meant to be used for error handling using `errors.As()`.
+type ErrNotFound struct {
+	path string
+	err  error
+}
+
+func (e ErrNotFound) Error() string {
+	return fmt.Sprintf("file %q not found in Kong", e.path)
+}
+
+// Unwrap provides the Admin API error.
+func (e ErrNotFound) Unwrap() error {
+	return e.err
+}
+
+// IsNotFound indicates whether the error reports a File which does not exist in Kong.
+func IsNotFound(err error) bool {
+	return errors.As(err, &ErrNotFound{})
+}
+
+// notFoundOr converts an Admin API 404 into an ErrNotFound, other errors are returned as is.
+func notFoundOr(path string, err error) error {
+	if kong.IsNotFoundErr(err) {
+		return ErrNotFound{path: path, err: err}
+	}
+	return err
+}
+
+// ErrPermanent error is returned when the Admin API refused a request which would fail again if retried
+// as is, e.g. a validation error. This type is meant to be used for error handling using `errors.As()`.
+type ErrPermanent struct {
+	err error
+}
+
+func (e ErrPermanent) Error() string {
+	return fmt.Sprintf("permanent failure: %v", e.err)
+}
+
+// Unwrap provides the Admin API error.
+func (e ErrPermanent) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error as a failure which cannot be solved by retrying the request.
+func Permanent(err error) error {
+	return ErrPermanent{err: err}
+}
+
+// IsPermanent indicates whether the error reports a failure which cannot be solved by retrying the request.
+func IsPermanent(err error) bool {
+	return errors.As(err, &ErrPermanent{})
+}
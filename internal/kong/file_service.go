@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/kong/go-kong/kong"
+	"net/url"
 	"strings"
 )
 
@@ -17,21 +18,40 @@ type AbstractFileService interface {
 	Update(ctx context.Context, file *File) (*File, error)
 	// Delete deletes a File in Kong
 	Delete(ctx context.Context, file *File) error
+	// List fetches a page of Files in Kong.
+	List(ctx context.Context, opt *ListOpt) ([]*File, *ListOpt, error)
+	// ListAll fetches all Files in Kong whose path starts with the prefix.
+	ListAll(ctx context.Context, prefix string) ([]*File, error)
 }
 
+// defaultPageSize is the number of Files requested per page when listing.
+const defaultPageSize = 1000
+
 // FileService handles Files in Kong.
 type FileService struct {
 	client *kong.Client
 }
 
+var _ AbstractFileService = (*FileService)(nil)
+
 // Is empty
 func isEmptyString(s *string) bool {
 	return s == nil || strings.TrimSpace(*s) == ""
 }
 
-func NewFileService(kongClient *kong.Client) (fileService FileService) {
+// fileEndpoint provides the Admin API endpoint of a File, each segment of its path being escaped
+// so that characters such as spaces or "?" are sent as part of the path.
+func fileEndpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/files/" + strings.Join(segments, "/")
+}
+
+func NewFileService(kongClient *kong.Client) *FileService {
 
-	return FileService{
+	return &FileService{
 		client: kongClient,
 	}
 }
@@ -43,7 +63,11 @@ func NewFileService(kongClient *kong.Client) (fileService FileService) {
 func (s *FileService) Create(ctx context.Context,
 	file *File) (*File, error) {
 
-	endpoint := fmt.Sprintf("/files/%v", *file.Path)
+	if isEmptyString(file.Path) {
+		return nil, fmt.Errorf("Path cannot be nil for Create operation")
+	}
+
+	endpoint := fileEndpoint(*file.Path)
 	req, err := s.client.NewRequest("PUT", endpoint, nil, file)
 	if err != nil {
 		return nil, err
@@ -58,13 +82,14 @@ func (s *FileService) Create(ctx context.Context,
 }
 
 // Get fetches a File in Kong.
+// An ErrNotFound is returned when the File does not exist.
 func (s *FileService) Get(ctx context.Context, file *File) (*File, error) {
 
 	if isEmptyString(file.Path) {
 		return nil, fmt.Errorf("Path cannot be nil for Get operation")
 	}
 
-	endpoint := fmt.Sprintf("/files/%v", *file.Path)
+	endpoint := fileEndpoint(*file.Path)
 	req, err := s.client.NewRequest("GET", endpoint, nil, nil)
 	if err != nil {
 		return nil, err
@@ -73,7 +98,7 @@ func (s *FileService) Get(ctx context.Context, file *File) (*File, error) {
 	var response File
 	_, err = s.client.Do(ctx, req, &response)
 	if err != nil {
-		return nil, err
+		return nil, notFoundOr(*file.Path, err)
 	}
 	return &response, nil
 }
@@ -85,7 +110,7 @@ func (s *FileService) Update(ctx context.Context, file *File) (*File, error) {
 		return nil, fmt.Errorf("Path cannot be nil for Update operation")
 	}
 
-	endpoint := fmt.Sprintf("/files/%v", *file.Path)
+	endpoint := fileEndpoint(*file.Path)
 	req, err := s.client.NewRequest("PUT", endpoint, nil, file)
 	if err != nil {
 		return nil, err
@@ -100,18 +125,84 @@ func (s *FileService) Update(ctx context.Context, file *File) (*File, error) {
 }
 
 // Delete deletes a File in Kong
-func (s *FileService) Delete(ctx context.Context, file *File) (*File, error) {
+// An ErrNotFound is returned when the File does not exist.
+func (s *FileService) Delete(ctx context.Context, file *File) error {
 
 	if isEmptyString(file.Path) {
-		return file, fmt.Errorf("Path cannot be nil for Delete operation")
+		return fmt.Errorf("Path cannot be nil for Delete operation")
 	}
 
-	endpoint := fmt.Sprintf("/files/%v", *file.Path)
+	endpoint := fileEndpoint(*file.Path)
 	req, err := s.client.NewRequest("DELETE", endpoint, nil, nil)
 	if err != nil {
-		return file, err
+		return err
 	}
 
 	_, err = s.client.Do(ctx, req, nil)
-	return file, err
+	if err != nil {
+		return notFoundOr(*file.Path, err)
+	}
+	return nil
+}
+
+// List fetches a page of Files in Kong.
+// opt can be used to control pagination and to filter Files by path prefix,
+// the next page options are nil once the last page is reached.
+func (s *FileService) List(ctx context.Context, opt *ListOpt) ([]*File, *ListOpt, error) {
+	if opt == nil {
+		opt = &ListOpt{}
+	}
+
+	req, err := s.client.NewRequest("GET", "/files", opt, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var response struct {
+		Data   []*File `json:"data"`
+		Offset *string `json:"offset"`
+	}
+	_, err = s.client.Do(ctx, req, &response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the Admin API has no path filter, so the prefix is applied on each page
+	files := response.Data
+	if opt.Prefix != "" {
+		files = make([]*File, 0, len(response.Data))
+		for _, file := range response.Data {
+			if file.Path != nil && strings.HasPrefix(*file.Path, opt.Prefix) {
+				files = append(files, file)
+			}
+		}
+	}
+
+	var next *ListOpt
+	if response.Offset != nil && *response.Offset != "" {
+		next = &ListOpt{Size: opt.Size, Offset: *response.Offset, Prefix: opt.Prefix}
+	}
+	return files, next, nil
+}
+
+// ListAll fetches all Files in Kong whose path starts with the prefix,
+// following the pagination of the Admin API. An empty prefix matches all Files.
+func (s *FileService) ListAll(ctx context.Context, prefix string) ([]*File, error) {
+	return listAll(ctx, s, prefix)
+}
+
+// listAll fetches all Files in Kong whose path starts with the prefix through the List of the service,
+// page by page, so that the wrapping services apply to each page on its own.
+func listAll(ctx context.Context, service AbstractFileService, prefix string) ([]*File, error) {
+	var files []*File
+	opt := &ListOpt{Size: defaultPageSize, Prefix: prefix}
+	for opt != nil {
+		page, next, err := service.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+		opt = next
+	}
+	return files, nil
 }
@@ -0,0 +1,180 @@
+package kong
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kong/go-kong/kong"
+)
+
+func TestFileEndpoint(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{path: "content/index.md", want: "/files/content/index.md"},
+		{path: "base/assets/images/logo.png", want: "/files/base/assets/images/logo.png"},
+		{path: "content/getting started/first steps.md", want: "/files/content/getting%20started/first%20steps.md"},
+		{path: "content/faq/why?.md", want: "/files/content/faq/why%3F.md"},
+		{path: "content/a#b.md", want: "/files/content/a%23b.md"},
+		{path: "content/100%.md", want: "/files/content/100%25.md"},
+		{path: "content/a;b.md", want: "/files/content/a%3Bb.md"},
+		{path: "content//index.md", want: "/files/content//index.md"},
+		{path: "content/./index.md", want: "/files/content/./index.md"},
+		{path: "content/../specs/petstore.yaml", want: "/files/content/../specs/petstore.yaml"},
+		{path: `content/a\b.md`, want: "/files/content/a%5Cb.md"},
+		{path: "content/a\nb.md", want: "/files/content/a%0Ab.md"},
+		{path: "content/é.md", want: "/files/content/%C3%A9.md"},
+		{path: "", want: "/files/"},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := fileEndpoint(tt.path); got != tt.want {
+				t.Errorf("fileEndpoint(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// testPages are the pages of Files served by the test Admin API, by offset.
+var testPages = map[string]struct {
+	paths []string
+	next  string
+}{
+	"":       {paths: []string{"content/index.md", "themes/base/layouts/index.html"}, next: "page-2"},
+	"page-2": {paths: []string{"specs/petstore.yaml", "content/guides/guide.md"}, next: "page-3"},
+	"page-3": {paths: []string{"contents.md", "content/faq.md"}},
+}
+
+// newTestFileService provides a FileService of an Admin API serving testPages, in which only the File
+// at content/index.md can be fetched and deleted, and the requests made to it.
+func newTestFileService(t *testing.T) (*FileService, *[]string) {
+	t.Helper()
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.URL.Path == "/files" {
+			page, ok := testPages[r.URL.Query().Get("offset")]
+			if !ok || r.URL.Query().Get("size") != "1000" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data := make([]map[string]string, 0, len(page.paths))
+			for _, path := range page.paths {
+				data = append(data, map[string]string{"id": path, "path": path})
+			}
+			response := map[string]interface{}{"data": data}
+			if page.next != "" {
+				response["offset"] = page.next
+				response["next"] = "/files?offset=" + page.next
+			}
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+		if r.URL.Path != "/files/content/index.md" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not found"}`))
+			return
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": "index", "path": "content/index.md", "contents": "# Index"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := kong.NewClient(kong.String(server.URL), server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFileService(client), &requests
+}
+
+func TestFileServiceListAll(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "content/", want: []string{"content/faq.md", "content/guides/guide.md", "content/index.md"}},
+		{prefix: "themes/", want: []string{"themes/base/layouts/index.html"}},
+		{prefix: "", want: []string{
+			"content/faq.md", "content/guides/guide.md", "content/index.md", "contents.md",
+			"specs/petstore.yaml", "themes/base/layouts/index.html",
+		}},
+		{prefix: "assets/"},
+	} {
+		t.Run(tt.prefix, func(t *testing.T) {
+			service, requests := newTestFileService(t)
+
+			files, err := service.ListAll(context.Background(), tt.prefix)
+			if err != nil {
+				t.Fatalf("ListAll() unexpected error: %v", err)
+			}
+			var paths []string
+			for _, file := range files {
+				paths = append(paths, *file.Path)
+			}
+			sort.Strings(paths)
+			if strings.Join(paths, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListAll(%q) = %v, want %v", tt.prefix, paths, tt.want)
+			}
+			// every page is fetched, following the offset of the previous one
+			want := []string{"GET /files?size=1000", "GET /files?offset=page-2&size=1000", "GET /files?offset=page-3&size=1000"}
+			if strings.Join(*requests, ",") != strings.Join(want, ",") {
+				t.Errorf("requests = %v, want %v", *requests, want)
+			}
+		})
+	}
+}
+
+func TestFileServiceList(t *testing.T) {
+	service, _ := newTestFileService(t)
+
+	files, next, err := service.List(context.Background(), &ListOpt{Size: 1000, Offset: "page-2", Prefix: "content/"})
+	if err != nil {
+		t.Fatalf("List() unexpected error: %v", err)
+	}
+	if len(files) != 1 || *files[0].Path != "content/guides/guide.md" {
+		t.Errorf("List() = %v, want the prefixed File of the page", files)
+	}
+	if next == nil || *next != (ListOpt{Size: 1000, Offset: "page-3", Prefix: "content/"}) {
+		t.Errorf("List() next = %+v, want the options of the following page", next)
+	}
+
+	_, next, err = service.List(context.Background(), &ListOpt{Size: 1000, Offset: "page-3"})
+	if err != nil {
+		t.Fatalf("List() unexpected error: %v", err)
+	}
+	if next != nil {
+		t.Errorf("List() next = %+v on the last page, want none", next)
+	}
+}
+
+func TestFileServiceNotFound(t *testing.T) {
+	service, _ := newTestFileService(t)
+	missing := &File{Path: kong.String("content/missing.md")}
+
+	if _, err := service.Get(context.Background(), missing); !IsNotFound(err) {
+		t.Errorf("Get() error = %v, want a not found error", err)
+	}
+	if err := service.Delete(context.Background(), missing); !IsNotFound(err) {
+		t.Errorf("Delete() error = %v, want a not found error", err)
+	}
+
+	existing := &File{Path: kong.String("content/index.md")}
+	file, err := service.Get(context.Background(), existing)
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if *file.Contents != "# Index" {
+		t.Errorf("Get() contents = %q, want %q", *file.Contents, "# Index")
+	}
+	if err := service.Delete(context.Background(), existing); err != nil {
+		t.Errorf("Delete() unexpected error: %v", err)
+	}
+}
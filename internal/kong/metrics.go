@@ -0,0 +1,122 @@
+package kong
+
+import (
+	"context"
+	"time"
+
+	"kong-portal-controller/internal/metrics"
+)
+
+// InstrumentedFileService handles Files in Kong through another AbstractFileService, recording the outcome
+// and the duration of every call in the Admin API metrics.
+type InstrumentedFileService struct {
+	service AbstractFileService
+
+	workspace   string
+	kindOf      func(path string) string
+	promMetrics *metrics.FileServiceMetrics
+}
+
+var _ AbstractFileService = &InstrumentedFileService{}
+
+// NewInstrumentedFileService provides an InstrumentedFileService recording the calls made in the workspace,
+// labelled with the kind of the KongFiles published at the paths of the Files as provided by kindOf.
+func NewInstrumentedFileService(
+	service AbstractFileService,
+	workspace string,
+	kindOf func(path string) string,
+	promMetrics *metrics.FileServiceMetrics,
+) *InstrumentedFileService {
+	return &InstrumentedFileService{
+		service:     service,
+		workspace:   workspace,
+		kindOf:      kindOf,
+		promMetrics: promMetrics,
+	}
+}
+
+// Create creates a File in Kong.
+func (s *InstrumentedFileService) Create(ctx context.Context, file *File) (*File, error) {
+	var response *File
+	err := s.observe(metrics.OperationCreate, pathOf(file), func() (err error) {
+		response, err = s.service.Create(ctx, file)
+		return err
+	})
+	return response, err
+}
+
+// Get fetches a File in Kong.
+// An ErrNotFound is returned when the File does not exist.
+func (s *InstrumentedFileService) Get(ctx context.Context, file *File) (*File, error) {
+	var response *File
+	err := s.observe(metrics.OperationGet, pathOf(file), func() (err error) {
+		response, err = s.service.Get(ctx, file)
+		return err
+	})
+	return response, err
+}
+
+// Update updates a File in Kong
+func (s *InstrumentedFileService) Update(ctx context.Context, file *File) (*File, error) {
+	var response *File
+	err := s.observe(metrics.OperationUpdate, pathOf(file), func() (err error) {
+		response, err = s.service.Update(ctx, file)
+		return err
+	})
+	return response, err
+}
+
+// Delete deletes a File in Kong
+// An ErrNotFound is returned when the File does not exist.
+func (s *InstrumentedFileService) Delete(ctx context.Context, file *File) error {
+	return s.observe(metrics.OperationDelete, pathOf(file), func() error {
+		return s.service.Delete(ctx, file)
+	})
+}
+
+// List fetches a page of Files in Kong.
+func (s *InstrumentedFileService) List(ctx context.Context, opt *ListOpt) ([]*File, *ListOpt, error) {
+	var files []*File
+	var next *ListOpt
+	prefix := ""
+	if opt != nil {
+		prefix = opt.Prefix
+	}
+	err := s.observe(metrics.OperationList, prefix, func() (err error) {
+		files, next, err = s.service.List(ctx, opt)
+		return err
+	})
+	return files, next, err
+}
+
+// ListAll fetches all Files in Kong whose path starts with the prefix,
+// each page being recorded on its own.
+func (s *InstrumentedFileService) ListAll(ctx context.Context, prefix string) ([]*File, error) {
+	return listAll(ctx, s, prefix)
+}
+
+// observe records the outcome and the duration of a call for the File at the path, or the Files
+// under the path for lists.
+func (s *InstrumentedFileService) observe(operation, path string, call func() error) error {
+	start := time.Now()
+	err := call()
+	duration := time.Since(start)
+
+	// a File found not to exist is an expected outcome, e.g. of the existence checks and of idempotent deletes
+	success := metrics.SuccessTrue
+	if err != nil && !IsNotFound(err) {
+		success = metrics.SuccessFalse
+	}
+	kind := s.kindOf(path)
+	s.promMetrics.ConfigPushCount.WithLabelValues(success, kind, s.workspace, operation).Inc()
+	s.promMetrics.ConfigPushDuration.WithLabelValues(success, kind, s.workspace, operation).Observe(float64(duration.Milliseconds()))
+	return err
+}
+
+// pathOf provides the path of a File, empty when it has none.
+func pathOf(file *File) string {
+	if file == nil || file.Path == nil {
+		return ""
+	}
+	return *file.Path
+}
@@ -0,0 +1,55 @@
+package kong
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kong/go-kong/kong"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"kong-portal-controller/internal/metrics"
+)
+
+// erroringFileService fails the fetches with err.
+type erroringFileService struct {
+	AbstractFileService
+	err error
+}
+
+func (s erroringFileService) Get(_ context.Context, file *File) (*File, error) {
+	return file, s.err
+}
+
+func TestInstrumentedFileServiceOutcome(t *testing.T) {
+	promMetrics := metrics.NewFileServiceMetrics()
+	kindOf := func(string) string { return "CONTENT" }
+
+	for _, tt := range []struct {
+		name        string
+		err         error
+		wantSuccess string
+	}{
+		{name: "success", wantSuccess: metrics.SuccessTrue},
+		{name: "not found", err: notFoundOr("content/index.md", kong.NewAPIError(http.StatusNotFound, "not found")), wantSuccess: metrics.SuccessTrue},
+		{name: "server error", err: kong.NewAPIError(http.StatusInternalServerError, "error"), wantSuccess: metrics.SuccessFalse},
+		{name: "network error", err: errors.New("connection refused"), wantSuccess: metrics.SuccessFalse},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			promMetrics.ConfigPushCount.Reset()
+			s := NewInstrumentedFileService(erroringFileService{err: tt.err}, "portal", kindOf, promMetrics)
+
+			if _, err := s.Get(context.Background(), &File{Path: kong.String("content/index.md")}); !errors.Is(err, tt.err) {
+				t.Errorf("Get() error = %v, want %v", err, tt.err)
+			}
+			count := promMetrics.ConfigPushCount.WithLabelValues(tt.wantSuccess, "CONTENT", "portal", metrics.OperationGet)
+			if got := testutil.ToFloat64(count); got != 1 {
+				t.Errorf("%s{success=%q} = %g, want 1", metrics.MetricNameConfigPushCount, tt.wantSuccess, got)
+			}
+			if got := testutil.CollectAndCount(promMetrics.ConfigPushCount); got != 1 {
+				t.Errorf("%s holds %d series, want only the call outcome", metrics.MetricNameConfigPushCount, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package kong
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/kong/go-kong/kong"
+)
+
+const (
+	// defaultRetryBaseDelay is the delay before the first retry, doubled for each following retry.
+	defaultRetryBaseDelay = 500 * time.Millisecond
+
+	// defaultRetryMaxDelay caps the delay between two retries.
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// RetryingFileService handles Files in Kong through another AbstractFileService, applying a deadline
+// to every request and retrying failed ones with an exponential backoff. Requests refused by the Admin API
+// as invalid or unauthorized are returned as an ErrPermanent, while other failures, such as throttling,
+// server or network errors, are retried.
+type RetryingFileService struct {
+	service AbstractFileService
+
+	timeout    time.Duration
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+var _ AbstractFileService = &RetryingFileService{}
+
+// NewRetryingFileService provides a RetryingFileService allowing timeout for each request,
+// and retrying failed requests at most maxRetries times.
+func NewRetryingFileService(service AbstractFileService, timeout time.Duration, maxRetries int) *RetryingFileService {
+	return &RetryingFileService{
+		service:    service,
+		timeout:    timeout,
+		maxRetries: maxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+	}
+}
+
+// Create creates a File in Kong.
+func (s *RetryingFileService) Create(ctx context.Context, file *File) (*File, error) {
+	var response *File
+	err := s.do(ctx, func(ctx context.Context) (err error) {
+		response, err = s.service.Create(ctx, file)
+		return err
+	})
+	return response, err
+}
+
+// Get fetches a File in Kong.
+// An ErrNotFound is returned when the File does not exist.
+func (s *RetryingFileService) Get(ctx context.Context, file *File) (*File, error) {
+	var response *File
+	err := s.do(ctx, func(ctx context.Context) (err error) {
+		response, err = s.service.Get(ctx, file)
+		return err
+	})
+	return response, err
+}
+
+// Update updates a File in Kong
+func (s *RetryingFileService) Update(ctx context.Context, file *File) (*File, error) {
+	var response *File
+	err := s.do(ctx, func(ctx context.Context) (err error) {
+		response, err = s.service.Update(ctx, file)
+		return err
+	})
+	return response, err
+}
+
+// Delete deletes a File in Kong
+// An ErrNotFound is returned when the File does not exist.
+func (s *RetryingFileService) Delete(ctx context.Context, file *File) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.service.Delete(ctx, file)
+	})
+}
+
+// List fetches a page of Files in Kong.
+func (s *RetryingFileService) List(ctx context.Context, opt *ListOpt) ([]*File, *ListOpt, error) {
+	var files []*File
+	var next *ListOpt
+	err := s.do(ctx, func(ctx context.Context) (err error) {
+		files, next, err = s.service.List(ctx, opt)
+		return err
+	})
+	return files, next, err
+}
+
+// ListAll fetches all Files in Kong whose path starts with the prefix,
+// each page being retried on its own.
+func (s *RetryingFileService) ListAll(ctx context.Context, prefix string) ([]*File, error) {
+	return listAll(ctx, s, prefix)
+}
+
+// do runs the request with a deadline until it succeeds, fails permanently, the retries are
+// exhausted or the context is done.
+func (s *RetryingFileService) do(ctx context.Context, request func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := s.attempt(ctx, request)
+		if err == nil || IsNotFound(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if isPermanent(err) {
+			return ErrPermanent{err: err}
+		}
+		if attempt >= s.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s.backoff(attempt)):
+		}
+	}
+}
+
+// attempt runs the request once, within the request timeout.
+func (s *RetryingFileService) attempt(ctx context.Context, request func(ctx context.Context) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return request(ctx)
+}
+
+// backoff provides the delay before the retry following the provided attempt: the delay doubles
+// with every attempt, up to maxDelay, and is jittered so that concurrent clients don't retry in sync.
+func (s *RetryingFileService) backoff(attempt int) time.Duration {
+	delay := s.maxDelay
+	if attempt < 32 && s.baseDelay<<attempt < s.maxDelay {
+		delay = s.baseDelay << attempt
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isPermanent indicates whether the request would fail again if sent as is: the Admin API refused it
+// as invalid, conflicting with its state or too large, or the credentials of the controller are refused,
+// which takes a configuration change to solve.
+func isPermanent(err error) bool {
+	var apiErr *kong.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code() {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict,
+		http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,209 @@
+package kong
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kong/go-kong/kong"
+)
+
+func TestIsPermanent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "bad request", err: kong.NewAPIError(http.StatusBadRequest, "invalid"), want: true},
+		{name: "conflict", err: kong.NewAPIError(http.StatusConflict, "exists"), want: true},
+		{name: "too large", err: kong.NewAPIError(http.StatusRequestEntityTooLarge, "too large"), want: true},
+		{name: "unprocessable", err: kong.NewAPIError(http.StatusUnprocessableEntity, "invalid"), want: true},
+		{name: "wrapped bad request", err: fmt.Errorf("update: %w", kong.NewAPIError(http.StatusBadRequest, "invalid")), want: true},
+		{name: "unauthorized", err: kong.NewAPIError(http.StatusUnauthorized, "no credentials"), want: true},
+		{name: "forbidden", err: kong.NewAPIError(http.StatusForbidden, "no permission"), want: true},
+		{name: "not found", err: kong.NewAPIError(http.StatusNotFound, "not found")},
+		{name: "request timeout", err: kong.NewAPIError(http.StatusRequestTimeout, "timeout")},
+		{name: "too many requests", err: kong.NewAPIError(http.StatusTooManyRequests, "throttled")},
+		{name: "internal server error", err: kong.NewAPIError(http.StatusInternalServerError, "error")},
+		{name: "service unavailable", err: kong.NewAPIError(http.StatusServiceUnavailable, "unavailable")},
+		{name: "network", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}},
+		{name: "deadline", err: context.DeadlineExceeded},
+		{name: "other", err: errors.New("failure")},
+		{name: "nil", err: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanent(tt.err); got != tt.want {
+				t.Errorf("isPermanent(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingFileService fails the fetches with the errors in turn, the last one being returned once
+// the others are exhausted, and blocks the fetches until their context is done while hang is set.
+type failingFileService struct {
+	AbstractFileService
+	errs     []error
+	hang     bool
+	attempts int
+}
+
+func (s *failingFileService) Get(ctx context.Context, file *File) (*File, error) {
+	s.attempts++
+	if s.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	err := s.errs[0]
+	if len(s.errs) > 1 {
+		s.errs = s.errs[1:]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func newTestRetryingFileService(service AbstractFileService, timeout time.Duration, maxRetries int) *RetryingFileService {
+	s := NewRetryingFileService(service, timeout, maxRetries)
+	s.baseDelay, s.maxDelay = time.Millisecond, 4*time.Millisecond
+	return s
+}
+
+func TestRetryingFileServiceRetries(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		errs          []error
+		wantAttempts  int
+		wantErr       bool
+		wantPermanent bool
+		wantNotFound  bool
+	}{
+		{name: "success", errs: []error{nil}, wantAttempts: 1},
+		{
+			name:         "server error until the retries are exhausted",
+			errs:         []error{kong.NewAPIError(http.StatusInternalServerError, "error")},
+			wantAttempts: 4,
+			wantErr:      true,
+		},
+		{
+			name:         "throttled until the retries are exhausted",
+			errs:         []error{kong.NewAPIError(http.StatusTooManyRequests, "throttled")},
+			wantAttempts: 4,
+			wantErr:      true,
+		},
+		{
+			name:         "unavailable then success",
+			errs:         []error{kong.NewAPIError(http.StatusServiceUnavailable, "unavailable"), nil},
+			wantAttempts: 2,
+		},
+		{
+			name:          "bad request",
+			errs:          []error{kong.NewAPIError(http.StatusBadRequest, "invalid")},
+			wantAttempts:  1,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:          "conflict",
+			errs:          []error{kong.NewAPIError(http.StatusConflict, "exists")},
+			wantAttempts:  1,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:          "too large",
+			errs:          []error{kong.NewAPIError(http.StatusRequestEntityTooLarge, "too large")},
+			wantAttempts:  1,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:          "unprocessable",
+			errs:          []error{kong.NewAPIError(http.StatusUnprocessableEntity, "invalid")},
+			wantAttempts:  1,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:         "not found",
+			errs:         []error{notFoundOr("content/index.md", kong.NewAPIError(http.StatusNotFound, "not found"))},
+			wantAttempts: 1,
+			wantErr:      true,
+			wantNotFound: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &failingFileService{errs: tt.errs}
+			s := newTestRetryingFileService(service, time.Second, 3)
+
+			_, err := s.Get(context.Background(), &File{Path: kong.String("content/index.md")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, want an error %t", err, tt.wantErr)
+			}
+			if service.attempts != tt.wantAttempts {
+				t.Errorf("Get() made %d attempts, want %d", service.attempts, tt.wantAttempts)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent(%v) = %t, want %t", err, IsPermanent(err), tt.wantPermanent)
+			}
+			if IsNotFound(err) != tt.wantNotFound {
+				t.Errorf("IsNotFound(%v) = %t, want %t", err, IsNotFound(err), tt.wantNotFound)
+			}
+		})
+	}
+}
+
+func TestRetryingFileServiceTimeout(t *testing.T) {
+	service := &failingFileService{hang: true}
+	s := newTestRetryingFileService(service, 20*time.Millisecond, 1)
+
+	start := time.Now()
+	_, err := s.Get(context.Background(), &File{Path: kong.String("content/index.md")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want the deadline exceeded", err)
+	}
+	if service.attempts != 2 {
+		t.Errorf("Get() made %d attempts, want each one cancelled at its deadline", service.attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get() returned after %s, want the hanging requests cancelled", elapsed)
+	}
+
+	// a request cancelled by its caller is not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.attempts = 0
+	if _, err := s.Get(ctx, &File{Path: kong.String("content/index.md")}); !errors.Is(err, context.Canceled) || service.attempts != 1 {
+		t.Errorf("Get() = %v after %d attempts, want the cancellation after one", err, service.attempts)
+	}
+}
+
+func TestRetryingFileServiceBackoff(t *testing.T) {
+	s := NewRetryingFileService(nil, time.Second, 5)
+	s.baseDelay, s.maxDelay = 100*time.Millisecond, 2*time.Second
+	for _, tt := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 100 * time.Millisecond},
+		{attempt: 1, want: 200 * time.Millisecond},
+		{attempt: 3, want: 800 * time.Millisecond},
+		{attempt: 4, want: 1600 * time.Millisecond},
+		{attempt: 5, want: 2 * time.Second},
+		{attempt: 31, want: 2 * time.Second},
+		{attempt: 64, want: 2 * time.Second},
+	} {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if delay := s.backoff(tt.attempt); delay < tt.want/2 || delay > tt.want {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, delay, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -14,3 +14,13 @@ type File struct {
 	Path      *string `json:"path,omitempty" yaml:"path,omitempty"`
 	Contents  *string `json:"contents,omitempty" yaml:"contents,omitempty"`
 }
+
+// ListOpt aids in paginating through Files in Kong.
+type ListOpt struct {
+	// Size of the page
+	Size int `url:"size,omitempty"`
+	// Offset for the current page
+	Offset string `url:"offset,omitempty"`
+	// Prefix the paths of the listed Files start with
+	Prefix string `url:"-"`
+}
@@ -14,7 +14,9 @@ import (
 	"kong-portal-controller/internal/adminapi"
 	"kong-portal-controller/internal/admission"
 	"kong-portal-controller/internal/annotations"
+	"kong-portal-controller/internal/certwatch"
 	"kong-portal-controller/internal/dataplane/proxy"
+	developer "kong-portal-controller/pkg/apis/v1"
 )
 
 // -----------------------------------------------------------------------------
@@ -36,6 +38,8 @@ type Config struct {
 	KongWorkspace      string
 	AnonymousReports   bool
 	EnableReverseSync  bool
+	ReverseSyncPeriod  time.Duration
+	DriftPolicy        string
 	SyncPeriod         time.Duration
 
 	// Kong Proxy configurations
@@ -46,7 +50,10 @@ type Config struct {
 	ProbeAddr                string
 	KongAdminURL             string
 	ProxyTimeoutSeconds      float32
+	ProxySyncSeconds         float32
+	MaxFileSizes             map[string]int64
 	KongCustomEntitiesSecret string
+	ContentRoot              string
 
 	// Kubernetes configurations
 	KubeconfigPath          string
@@ -55,7 +62,6 @@ type Config struct {
 	LeaderElectionNamespace string
 	LeaderElectionID        string
 	Concurrency             int
-	FilterTags              []string
 	WatchNamespaces         []string
 
 	// Ingress status
@@ -63,10 +69,24 @@ type Config struct {
 	PublishStatusAddress []string
 
 	// Admission Webhook server config
-	AdmissionServer admission.ServerConfig
+	AdmissionServer                admission.ServerConfig
+	AdmissionPortalTheme           string
+	AdmissionLayoutPolicy          string
+	AdmissionKongFailurePolicy     string
+	AdmissionDeletionFailurePolicy string
+	AdmissionImmutableKind         bool
+	AdmissionDeleteProtection      bool
+
+	// Garbage collection of Kong files
+	EnableFilesGC     bool
+	FilesGCInterval   time.Duration
+	FilesGCPrefixes   []string
+	FilesGCDryRun     bool
+	FilesGCMaxRetries int
 
 	// Diagnostics and performance
-	EnableProfiling bool
+	EnableProfiling   bool
+	EnableConfigDumps bool
 }
 
 // -----------------------------------------------------------------------------
@@ -94,7 +114,10 @@ func (c *Config) FlagSet() *pflag.FlagSet {
 	flagSet.StringVar(&c.KongAdminToken, "kong-admin-token", "", `The Kong Enterprise RBAC token used by the controller.`)
 	flagSet.StringVar(&c.KongWorkspace, "kong-workspace", "", "Kong Enterprise workspace to configure. Leave this empty if not using Kong workspaces.")
 	flagSet.BoolVar(&c.AnonymousReports, "anonymous-reports", true, `Send anonymized usage data to help improve Kong`)
-	flagSet.BoolVar(&c.EnableReverseSync, "enable-reverse-sync", false, `Send developer to Kong even if the developer checksum has not changed since previous update.`)
+	flagSet.BoolVar(&c.EnableReverseSync, "enable-reverse-sync", false, `Periodically compare the files in Kong with the KongFiles and handle drifts according to the drift policy.`)
+	flagSet.DurationVar(&c.ReverseSyncPeriod, "reverse-sync-period", proxy.DefaultResyncPeriod, `Interval between two comparisons of the files in Kong with the KongFiles.`)
+	flagSet.StringVar(&c.DriftPolicy, "drift-policy", string(proxy.DriftPolicyCorrect), `How to handle a file in Kong which differs from its KongFile. Allowed values are correct, report and ignore. `+
+		`It can be overridden per KongFile with the `+annotations.DriftPolicyKey+` annotation.`)
 	flagSet.DurationVar(&c.SyncPeriod, "sync-period", time.Hour*48, `Relist and confirm cloud resources this often`) // 48 hours derived from controller-runtime defaults
 
 	flagSet.StringVar(&c.KongAdminAPIConfig.TLSClientCertPath, "kong-admin-tls-client-cert-file", "", "mTLS client certificate file for authentication.")
@@ -112,14 +135,24 @@ func (c *Config) FlagSet() *pflag.FlagSet {
 	flagSet.Float32Var(&c.ProxyTimeoutSeconds, "proxy-timeout-seconds", proxy.DefaultProxyTimeoutSeconds,
 		"Define the rate (in seconds) in which the timeout developer will be applied to the Kong client.",
 	)
+	flagSet.StringToInt64Var(&c.MaxFileSizes, "max-file-size", map[string]int64{
+		string(developer.CONTENT):       1 << 20,
+		string(developer.SPECIFICATION): 5 << 20,
+		string(developer.ASSET):         10 << 20,
+	}, `Maximum size in bytes of the published contents of each kind of KongFile, in the format "KIND=bytes", kinds without a limit are unbounded. `+
+		`Contents are measured once decoded according to spec.contentEncoding, and binary contents as is rather than as data URLs, both by the admission webhook and the controller.`)
+	flagSet.Float32Var(&c.ProxySyncSeconds, "proxy-sync-seconds", proxy.DefaultSyncSeconds,
+		"Define the delay (in seconds) between a change to an object and its application to the Kong Admin API, changes made meanwhile are applied at once.",
+	)
 	flagSet.StringVar(&c.KongCustomEntitiesSecret, "kong-custom-entities-secret", "", `A Secret containing custom entities for DB-less mode, in "namespace/name" format`)
+	flagSet.StringVar(&c.ContentRoot, "content-root", "", `Directory, such as a mounted volume, the spec.contentFrom.file of KongFiles are read from. `+
+		`Leave this empty to refuse reading KongFile contents from files.`)
 
 	// Kubernetes configurations
 	flagSet.StringVar(&c.KubeconfigPath, "kubeconfig", "", "Path to the kubeconfig file.")
 	flagSet.StringVar(&c.ControllerClassName, "controller-class", annotations.DefaultControllerClass, `Name of the controller class to route through this controller.`)
 	flagSet.StringVar(&c.LeaderElectionID, "election-id", "4g374a9e.konghq.com", `Election id to use for status update.`)
 	flagSet.StringVar(&c.LeaderElectionNamespace, "election-namespace", "", `Leader election namespace to use when running outside a cluster`)
-	flagSet.StringSliceVar(&c.FilterTags, "kong-admin-filter-tag", []string{"managed-by-portal-controller"}, "The tag used to manage and filter entities in Kong. This flag can be specified multiple times to specify multiple tags. This setting will be silently ignored if the Kong instance has no tags support.")
 	flagSet.IntVar(&c.Concurrency, "kong-admin-concurrency", 10, "Max number of concurrent requests sent to Kong's Admin API.")
 	flagSet.StringSliceVar(&c.WatchNamespaces, "watch-namespace", nil,
 		`Namespace(s) to watch for Kubernetes resources. Defaults to all namespaces. To watch multiple namespaces, use
@@ -145,21 +178,57 @@ func (c *Config) FlagSet() *pflag.FlagSet {
 		`admission server PEM certificate value`)
 	flagSet.StringVar(&c.AdmissionServer.Key, "admission-webhook-key", "",
 		`admission server PEM private key value`)
+	flagSet.StringVar(&c.AdmissionServer.Service, "admission-webhook-service", "",
+		`Service exposing the admission controller in "namespace/name" format; required when no certificate is supplied, `+
+			`the controller then generates a self-signed CA and a certificate for this Service`)
+	flagSet.StringVar(&c.AdmissionServer.CertSecret, "admission-webhook-cert-secret", admission.DefaultCertSecret,
+		`Secret of the admission webhook Service namespace storing the generated certificates; the RBAC manifests only grant the default name in the kong namespace`)
+	flagSet.StringVar(&c.AdmissionServer.WebhookConfiguration, "admission-webhook-configuration", admission.DefaultWebhookConfiguration,
+		`Name of the ValidatingWebhookConfiguration created when missing, and of the webhook configurations whose caBundle is set to the generated CA; the RBAC manifests only grant the default name`)
+	flagSet.StringVar(&c.AdmissionPortalTheme, "admission-webhook-portal-theme", "base",
+		`The portal theme whose layouts the layout of CONTENT KongFiles is checked against.`)
+	flagSet.StringVar(&c.AdmissionLayoutPolicy, "admission-webhook-layout-policy", string(admission.LayoutPolicyDeny),
+		`How CONTENT KongFiles whose layout does not exist in the portal theme are handled: "deny", "warn" or "ignore".`)
+	flagSet.StringVar(&c.AdmissionKongFailurePolicy, "admission-webhook-kong-failure-policy", string(admission.FailurePolicyIgnore),
+		`How KongFiles are handled when Kong is unreachable to check them, calls to Kong timing out after --proxy-timeout-seconds `+
+			`capped to `+admission.MaxKongTimeout.String()+`: "fail" rejects them, "ignore" accepts them with a warning.`)
+	flagSet.StringVar(&c.AdmissionDeletionFailurePolicy, "admission-webhook-deletion-failure-policy", string(admission.FailurePolicyIgnore),
+		`How the API server handles the deletions of KongFiles while the admission webhook is unreachable, set on the deletion webhook of the `+
+			`generated ValidatingWebhookConfiguration: "ignore" allows them without the delete protections, so that KongFiles and their namespaces can be deleted `+
+			`while the controller is down, "fail" rejects them.`)
+	flagSet.BoolVar(&c.AdmissionImmutableKind, "admission-webhook-immutable-kind", true,
+		`Deny the updates changing the kind of a KongFile.`)
+	flagSet.BoolVar(&c.AdmissionDeleteProtection, "admission-webhook-delete-protection", true,
+		`Deny the deletion of ASSET KongFiles linked from the inline content of CONTENT KongFiles or from the layouts of the portal theme.`)
+
+	// Garbage collection of Kong files
+	flagSet.BoolVar(&c.EnableFilesGC, "enable-files-gc", false, `Periodically delete the Kong files owned by the controller which are not backed by any KongFile.`)
+	flagSet.DurationVar(&c.FilesGCInterval, "files-gc-interval", 10*time.Minute, `Interval between two garbage collections of Kong files.`)
+	flagSet.StringSliceVar(&c.FilesGCPrefixes, "files-gc-path-prefix", nil, `Kong file path prefix owned by the controller (e.g. "content/products/"), only files under these prefixes are garbage collected. This flag can be specified multiple times.`)
+	flagSet.BoolVar(&c.FilesGCDryRun, "files-gc-dry-run", false, `Only report the Kong files the garbage collection would delete.`)
+	flagSet.IntVar(&c.FilesGCMaxRetries, "files-gc-max-retries", 5, `Max number of times a failed request of the garbage collection to the Kong Admin API is retried, `+
+		`unless Kong refused it as invalid or unauthorized (400, 401, 403, 409, 413 or 422).`)
 
 	// Diagnostics
 	flagSet.BoolVar(&c.EnableProfiling, "profiling", false, fmt.Sprintf("Enable profiling via web interface host:%v/debug/pprof/", DiagnosticsPort))
+	flagSet.BoolVar(&c.EnableConfigDumps, "dump-config", false, fmt.Sprintf("Enable config dumps via web interface host:%v/debug/config/", DiagnosticsPort))
 
 	flagSet.Int("stderrthreshold", 0, "DEPRECATED: has no effect and will be removed in future releases (see github issue #1297)")
 	flagSet.Bool("update-status-on-shutdown", false, `DEPRECATED: no longer has any effect and will be removed in a later release (see github issue #1304)`)
+	flagSet.StringSlice("kong-admin-filter-tag", nil, `DEPRECATED: has no effect and will be removed in a later release, Kong portal files have no tags: `+
+		`the files owned by the controller are selected by --files-gc-path-prefix`)
+	flagSet.IntVar(&c.FilesGCMaxRetries, "proxy-max-retries", 5, `DEPRECATED: use --files-gc-max-retries, the failed changes of KongFiles `+
+		`are retried by the controller queue with a jittered exponential backoff`)
 
 	return flagSet
 }
 
-func (c *Config) GetKongClient(ctx context.Context) (*kong.Client, error) {
+// GetKongClient provides the Kong Admin API client, whose TLS files are reloaded by the watcher unless it is nil.
+func (c *Config) GetKongClient(ctx context.Context, watcher *certwatch.Watcher) (*kong.Client, error) {
 	if c.KongAdminToken != "" {
 		c.KongAdminAPIConfig.Headers = append(c.KongAdminAPIConfig.Headers, "kong-admin-token:"+c.KongAdminToken)
 	}
-	httpclient, err := adminapi.MakeHTTPClient(&c.KongAdminAPIConfig)
+	httpclient, err := adminapi.MakeHTTPClient(&c.KongAdminAPIConfig, watcher)
 	if err != nil {
 		return nil, err
 	}
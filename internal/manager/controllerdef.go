@@ -72,7 +72,10 @@ func setupControllers(mgr manager.Manager, proxy proxy.Proxy, c *Config) ([]Cont
 				Log:                 ctrl.Log.WithName("controllers").WithName("KongFile"),
 				Scheme:              mgr.GetScheme(),
 				Proxy:               proxy,
+				Recorder:            mgr.GetEventRecorderFor("kong-portal-controller"),
+				APIReader:           mgr.GetAPIReader(),
 				ControllerClassName: c.ControllerClassName,
+				ContentRoot:         c.ContentRoot,
 			},
 		},
 	}
@@ -13,6 +13,9 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
+	"kong-portal-controller/internal/certwatch"
+	"kong-portal-controller/internal/dataplane/configuration"
+	"kong-portal-controller/internal/dataplane/proxy"
 	"kong-portal-controller/internal/manager/metadata"
 	"kong-portal-controller/internal/util"
 	developer "kong-portal-controller/pkg/apis/v1"
@@ -22,8 +25,9 @@ import (
 // Controller Manager - Setup & Run
 // -----------------------------------------------------------------------------
 
-// Run starts the controller manager and blocks until it exits.
-func Run(ctx context.Context, c *Config) error {
+// Run starts the controller manager and blocks until it exits. The configuration applied to Kong is
+// dumped into configDumps, unless it is nil.
+func Run(ctx context.Context, c *Config, configDumps chan *configuration.KongConfigUpdate) error {
 	logger, err := setupLoggers(c)
 	if err != nil {
 		return err
@@ -49,8 +53,11 @@ func Run(ctx context.Context, c *Config) error {
 		return fmt.Errorf("get kubeconfig from file %q: %w", c.KubeconfigPath, err)
 	}
 
+	// the TLS files of the Admin API client and of the admission server are watched once the manager starts
+	certWatcher := certwatch.NewWatcher(ctrl.Log.WithName("certwatch"))
+
 	setupLog.Info("Getting the kong admin api client")
-	kongConfig, err := setupKongConfig(ctx, setupLog, c)
+	kongConfig, err := setupKongConfig(ctx, setupLog, c, configDumps, certWatcher)
 	if err != nil {
 		return fmt.Errorf("unable to build the kong admin api developer: %w", err)
 	}
@@ -82,19 +89,42 @@ func Run(ctx context.Context, c *Config) error {
 		return fmt.Errorf("unable to start controller manager: %w", err)
 	}
 
+	setupLog.Info("Indexing KongFiles by Kong path")
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &developer.KongFile{}, proxy.KongPathIndexKey, proxy.KongPathIndexer); err != nil {
+		return fmt.Errorf("unable to index KongFiles: %w", err)
+	}
+	setupLog.Info("Indexing KongFiles by content reference")
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &developer.KongFile{}, proxy.ContentRefIndexKey, proxy.ContentRefIndexer); err != nil {
+		return fmt.Errorf("unable to index KongFiles: %w", err)
+	}
+
+	fileService := setupFileService(kongConfig)
+
 	setupLog.Info("Starting Admission Server")
-	if err := setupAdmissionServer(ctx, c, mgr.GetClient()); err != nil {
+	if err := setupAdmissionServer(ctx, c, mgr, fileService, certWatcher); err != nil {
 		return err
 	}
 
+	setupLog.Info("Watching TLS files")
+	if err := mgr.Add(certWatcher); err != nil {
+		return fmt.Errorf("unable to watch TLS files: %w", err)
+	}
+
 	setupLog.Info("Initializing Proxy Cache Server")
-	proxy, err := setupProxyServer(ctx, setupLog, mgr, kongConfig, c)
+	proxyServer, err := setupProxyServer(ctx, setupLog, mgr, kongConfig, fileService, c)
 	if err != nil {
 		return fmt.Errorf("unable to initialize proxy cache server: %w", err)
 	}
 
+	if c.EnableFilesGC {
+		setupLog.Info("Starting Kong files garbage collector", "prefixes", c.FilesGCPrefixes, "dryRun", c.FilesGCDryRun)
+		if err := setupGarbageCollector(mgr, proxyServer, fileService, c); err != nil {
+			return fmt.Errorf("unable to setup kong files garbage collector: %w", err)
+		}
+	}
+
 	setupLog.Info("Starting Enabled Controllers")
-	controllers, err := setupControllers(mgr, proxy, c)
+	controllers, err := setupControllers(mgr, proxyServer, c)
 	if err != nil {
 		return fmt.Errorf("unable to setup controller as expected %w", err)
 	}
@@ -105,13 +135,13 @@ func Run(ctx context.Context, c *Config) error {
 	}
 
 	//+kubebuilder:scaffold:builder
-	
+
 	setupLog.Info("Starting health check servers")
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
 		return fmt.Errorf("unable to setup healthz: %w", err)
 	}
 	if err := mgr.AddReadyzCheck("check", func(_ *http.Request) error {
-		if !proxy.IsReady() {
+		if !proxyServer.IsReady() {
 			return errors.New("proxy not yet configured")
 		}
 		return nil
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/bombsimon/logrusr/v2"
 	"kong-portal-controller/internal/dataplane/configuration"
+	"kong-portal-controller/internal/dataplane/gc"
 	"kong-portal-controller/internal/kong"
+	"kong-portal-controller/internal/metrics"
 	"kong-portal-controller/internal/store"
 	"strings"
 	"time"
@@ -13,12 +15,14 @@ import (
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"kong-portal-controller/internal/admission"
+	"kong-portal-controller/internal/certwatch"
 	"kong-portal-controller/internal/dataplane/proxy"
 	"kong-portal-controller/internal/util"
 )
@@ -93,8 +97,9 @@ func setupControllerOptions(logger logr.Logger, c *Config, scheme *runtime.Schem
 	return controllerOpts, nil
 }
 
-func setupKongConfig(ctx context.Context, logger logr.Logger, c *Config) (configuration.Kong, error) {
-	kongClient, err := c.GetKongClient(ctx)
+func setupKongConfig(ctx context.Context, logger logr.Logger, c *Config, configDumps chan *configuration.KongConfigUpdate,
+	certWatcher *certwatch.Watcher) (configuration.Kong, error) {
+	kongClient, err := c.GetKongClient(ctx, certWatcher)
 	if err != nil {
 		return configuration.Kong{}, fmt.Errorf("unable to build kong api client: %w", err)
 	}
@@ -103,26 +108,54 @@ func setupKongConfig(ctx context.Context, logger logr.Logger, c *Config) (config
 		URL:         c.KongAdminURL,
 		Concurrency: c.Concurrency,
 		Client:      kongClient,
-		ConfigDone:  make(chan *configuration.KongConfigUpdate),
+		ConfigDone:  configDumps,
 	}
 
 	return cfg, nil
 }
 
+// setupFileService provides the service handling files through the Admin API, recording every call
+// in the metrics. The proxy, the garbage collector and the admission server share it, retrying on top of it.
+func setupFileService(kongConfig configuration.Kong) kong.AbstractFileService {
+	return kong.NewInstrumentedFileService(kong.NewFileService(kongConfig.Client),
+		kongConfig.Client.Workspace(),
+		proxy.KindOfPath,
+		metrics.NewFileServiceMetrics())
+}
+
 func setupProxyServer(ctx context.Context,
 	logger logr.Logger,
 	mgr manager.Manager,
 	kongConfig configuration.Kong,
+	fileService kong.AbstractFileService,
 	c *Config,
 ) (proxy.Proxy, error) {
 
 	timeoutDuration, err := time.ParseDuration(fmt.Sprintf("%gs", c.ProxyTimeoutSeconds))
 	if err != nil {
-		logger.Error(err, "%s is not a valid number of seconds to the timeout config for the kong client")
+		return nil, fmt.Errorf("invalid --proxy-timeout-seconds %g: %w", c.ProxyTimeoutSeconds, err)
+	}
+
+	syncTickDuration, err := time.ParseDuration(fmt.Sprintf("%gs", c.ProxySyncSeconds))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --proxy-sync-seconds %g: %w", c.ProxySyncSeconds, err)
+	}
+
+	sizeLimits, err := proxy.ParseSizeLimits(c.MaxFileSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	driftPolicy, err := proxy.ParseDriftPolicy(c.DriftPolicy)
+	if err != nil {
 		return nil, err
 	}
+	if c.EnableReverseSync && c.ReverseSyncPeriod <= 0 {
+		return nil, fmt.Errorf("--reverse-sync-period must be positive, got %s", c.ReverseSyncPeriod)
+	}
 
-	service := kong.NewFileService(kongConfig.Client)
+	// the queue of the proxy retries the failed operations with its own jittered backoff, rather than its workers
+	service := kong.NewRetryingFileService(fileService, timeoutDuration, 0)
 
 	store := store.NewCacheStores(logger)
 
@@ -130,7 +163,11 @@ func setupProxyServer(ctx context.Context,
 		kongConfig,
 		c.ControllerClassName,
 		c.EnableReverseSync,
+		c.ReverseSyncPeriod,
+		driftPolicy,
 		timeoutDuration,
+		syncTickDuration,
+		sizeLimits,
 		store,
 		service,
 		ctx)
@@ -146,7 +183,41 @@ func setupProxyServer(ctx context.Context,
 	return proxyServer, nil
 }
 
-func setupAdmissionServer(ctx context.Context, managerConfig *Config, managerClient client.Client) error {
+func setupGarbageCollector(mgr manager.Manager,
+	proxyServer proxy.Proxy,
+	fileService kong.AbstractFileService,
+	c *Config,
+) error {
+	if len(c.FilesGCPrefixes) == 0 {
+		return fmt.Errorf("--enable-files-gc requires at least one --files-gc-path-prefix")
+	}
+	if c.FilesGCInterval <= 0 {
+		return fmt.Errorf("--files-gc-interval must be positive, got %s", c.FilesGCInterval)
+	}
+	if c.FilesGCMaxRetries < 0 {
+		return fmt.Errorf("--files-gc-max-retries cannot be negative, got %d", c.FilesGCMaxRetries)
+	}
+
+	timeoutDuration := time.Duration(float64(c.ProxyTimeoutSeconds) * float64(time.Second))
+	service := kong.NewRetryingFileService(fileService, timeoutDuration, c.FilesGCMaxRetries)
+
+	collector := gc.NewCollector(ctrl.Log.WithName("gc"),
+		mgr.GetClient(),
+		proxyServer,
+		service,
+		c.FilesGCPrefixes,
+		c.FilesGCInterval,
+		c.FilesGCDryRun)
+
+	return mgr.Add(collector)
+}
+
+func setupAdmissionServer(ctx context.Context, managerConfig *Config, mgr manager.Manager, fileService kong.AbstractFileService,
+	certWatcher *certwatch.Watcher) error {
+	if managerConfig.AdmissionServer.ListenAddr == admission.ListenOff {
+		return nil
+	}
+
 	customizedLogger, err := util.MakeLogger(managerConfig.LogLevel, managerConfig.LogFormat)
 	if err != nil {
 		return err
@@ -154,19 +225,78 @@ func setupAdmissionServer(ctx context.Context, managerConfig *Config, managerCli
 
 	logger := logrusr.New(customizedLogger)
 
-	srv, err := admission.MakeTLSServer(&managerConfig.AdmissionServer, &admission.RequestHandler{
+	sizeLimits, err := proxy.ParseSizeLimits(managerConfig.MaxFileSizes)
+	if err != nil {
+		return err
+	}
+	layoutPolicy, err := admission.ParseLayoutPolicy(managerConfig.AdmissionLayoutPolicy)
+	if err != nil {
+		return err
+	}
+	failurePolicy, err := admission.ParseFailurePolicy(managerConfig.AdmissionKongFailurePolicy)
+	if err != nil {
+		return err
+	}
+	deletionFailurePolicy, err := admission.ParseFailurePolicy(managerConfig.AdmissionDeletionFailurePolicy)
+	if err != nil {
+		return err
+	}
+
+	// the API server waits for the webhook, so requests to Kong are never retried and time out
+	// before the webhook does, for the Kong failure policy to apply
+	timeoutDuration := time.Duration(float64(managerConfig.ProxyTimeoutSeconds) * float64(time.Second))
+	if timeoutDuration > admission.MaxKongTimeout {
+		timeoutDuration = admission.MaxKongTimeout
+	}
+	admissionFileService := kong.NewRetryingFileService(fileService, timeoutDuration, 0)
+
+	var certificates *admission.CertificateManager
+	if managerConfig.AdmissionServer.UsesSelfManagedCertificates() {
+		service := strings.SplitN(managerConfig.AdmissionServer.Service, "/", 3)
+		if len(service) != 2 || service[0] == "" || service[1] == "" {
+			return fmt.Errorf("--admission-webhook-service was expected to be in format <namespace>/<name> "+
+				"to generate the admission webhook certificates but got %q", managerConfig.AdmissionServer.Service)
+		}
+		// the certificate manager only reads a Secret and the webhook configurations, which are not worth caching
+		uncachedClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			return err
+		}
+		certificates = admission.NewCertificateManager(
+			logger,
+			uncachedClient,
+			types.NamespacedName{Namespace: service[0], Name: service[1]},
+			managerConfig.AdmissionServer.CertSecret,
+			managerConfig.AdmissionServer.WebhookConfiguration,
+			deletionFailurePolicy,
+		)
+		if err := certificates.CheckPermissions(ctx); err != nil {
+			return err
+		}
+		if err := mgr.Add(certificates); err != nil {
+			return err
+		}
+	}
+
+	srv, err := admission.MakeTLSServer(logger, &managerConfig.AdmissionServer, &admission.RequestHandler{
 		Validator: admission.NewKongHTTPValidator(
 			logger,
-			managerClient,
+			mgr.GetClient(),
+			mgr.GetAPIReader(),
+			admissionFileService,
+			sizeLimits,
+			managerConfig.AdmissionPortalTheme,
+			layoutPolicy,
+			failurePolicy,
+			managerConfig.AdmissionImmutableKind,
+			managerConfig.AdmissionDeleteProtection,
+			managerConfig.ContentRoot,
 		),
-		Logger: logger,
-	})
+		ControllerClassName: managerConfig.ControllerClassName,
+		Logger:              logger,
+	}, certificates, certWatcher)
 	if err != nil {
 		return err
 	}
-	go func() {
-		err := srv.ListenAndServeTLS("", "")
-		logger.Error(err, "admission webhook server stopped")
-	}()
-	return nil
+	return mgr.Add(srv)
 }
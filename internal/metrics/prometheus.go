@@ -6,14 +6,20 @@ import (
 )
 
 type CtrlFuncMetrics struct {
-	// ConfigPushCount is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
-	ConfigPushCount *prometheus.CounterVec
-
 	// TranslationCount is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
 	TranslationCount *prometheus.CounterVec
 
-	// ConfigPushDuration is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
-	ConfigPushDuration *prometheus.HistogramVec
+	// ManagedFiles is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
+	ManagedFiles *prometheus.GaugeVec
+
+	// DriftedFiles is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
+	DriftedFiles prometheus.Gauge
+
+	// FailedFiles is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
+	FailedFiles prometheus.Gauge
+
+	// PublishedBytes is a Prometheus metric with semantics defined by its help string in NewCtrlFuncMetrics().
+	PublishedBytes prometheus.Gauge
 }
 
 const (
@@ -28,64 +34,222 @@ const (
 )
 
 const (
-	// ProtocolDBLess indicates that developer was sent to Kong using the DB-less protocol (POST /config).
-	ProtocolDBLess string = "db-less"
+	// KindKey defines the key of the metric label indicating the kind of the KongFile.
+	KindKey string = "kind"
+
+	// WorkspaceKey defines the key of the metric label indicating the Kong workspace the file belongs to.
+	WorkspaceKey string = "workspace"
+
+	// OperationKey defines the key of the metric label indicating which Admin API operation was performed.
+	OperationKey string = "operation"
+)
+
+const (
+	// OperationCreate indicates that a file was created in Kong.
+	OperationCreate string = "create"
+
+	// OperationGet indicates that a file was fetched from Kong.
+	OperationGet string = "get"
+
+	// OperationUpdate indicates that a file was created or updated in Kong.
+	OperationUpdate string = "update"
+
+	// OperationDelete indicates that a file was deleted from Kong.
+	OperationDelete string = "delete"
+
+	// OperationList indicates that a page of files was listed from Kong.
+	OperationList string = "list"
+)
+
+const (
+	// DryRunKey defines the key of the metric label indicating whether an operation was only simulated.
+	DryRunKey string = "dry_run"
+)
+
+const (
+	// CertificateKey defines the key of the metric label indicating which TLS certificate is described.
+	CertificateKey string = "certificate"
+)
 
-	// ProtocolDeck indicates that developer was sent to Kong using the DB mode protocol (deck sync).
-	ProtocolDeck string = "deck"
+const (
+	MetricNameFilesCollectedCount = "portal_controller_files_garbage_collected_count"
+)
 
-	// ProtocolKey defines the key of the metric label indicating which protocol KIC used to configure Kong.
-	ProtocolKey string = "protocol"
+const (
+	MetricNameCertificateExpiry      = "portal_controller_certificate_expiry_timestamp_seconds"
+	MetricNameCertificateReloadCount = "portal_controller_certificate_reload_count"
 )
 
 const (
 	MetricNameConfigPushCount    = "portal_controller_configuration_push_count"
 	MetricNameTranslationCount   = "portal_controller_translation_count"
 	MetricNameConfigPushDuration = "portal_controller_configuration_push_duration_milliseconds"
+	MetricNameManagedFiles       = "portal_controller_managed_files"
+	MetricNameDriftedFiles       = "portal_controller_drifted_files"
+	MetricNameFailedFiles        = "portal_controller_failed_files"
+	MetricNamePublishedBytes     = "portal_controller_published_bytes"
 )
 
 func NewCtrlFuncMetrics() *CtrlFuncMetrics {
 	controllerMetrics := &CtrlFuncMetrics{}
 
-	controllerMetrics.ConfigPushCount =
+	controllerMetrics.TranslationCount =
 		prometheus.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: MetricNameConfigPushCount,
-				Help: "Count of successful/failed developer pushes to Kong. `" +
-					ProtocolKey + "` describes the developer protocol (" + ProtocolDBLess + " or " +
-					ProtocolDeck + ") in use. `" +
+				Name: MetricNameTranslationCount,
+				Help: "Count of translations from KongFiles to Kong files. `" +
+					KindKey + "` describes the kind of the KongFile. `" +
 					SuccessKey + "` describes whether there were unrecoverable errors (`" +
 					SuccessFalse + "`) or not (`" + SuccessTrue + "`).",
 			},
-			[]string{SuccessKey, ProtocolKey},
+			[]string{SuccessKey, KindKey},
 		)
 
-	controllerMetrics.TranslationCount =
+	controllerMetrics.ManagedFiles =
+		prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: MetricNameManagedFiles,
+				Help: "Number of files published in Kong by the controller. `" +
+					KindKey + "` describes the kind of the KongFile.",
+			},
+			[]string{KindKey},
+		)
+
+	controllerMetrics.DriftedFiles =
+		prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: MetricNameDriftedFiles,
+				Help: "Number of files in Kong which differ from their KongFile since the last drift detection.",
+			},
+		)
+
+	controllerMetrics.FailedFiles =
+		prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: MetricNameFailedFiles,
+				Help: "Number of KongFiles whose last operation against the Admin API failed.",
+			},
+		)
+
+	controllerMetrics.PublishedBytes =
+		prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: MetricNamePublishedBytes,
+				Help: "Total size of the contents of the files published in Kong by the controller, in bytes.",
+			},
+		)
+
+	metrics.Registry.MustRegister(controllerMetrics.TranslationCount,
+		controllerMetrics.ManagedFiles, controllerMetrics.DriftedFiles, controllerMetrics.FailedFiles, controllerMetrics.PublishedBytes)
+
+	return controllerMetrics
+}
+
+type FileServiceMetrics struct {
+	// ConfigPushCount is a Prometheus metric with semantics defined by its help string in NewFileServiceMetrics().
+	ConfigPushCount *prometheus.CounterVec
+
+	// ConfigPushDuration is a Prometheus metric with semantics defined by its help string in NewFileServiceMetrics().
+	ConfigPushDuration *prometheus.HistogramVec
+}
+
+func NewFileServiceMetrics() *FileServiceMetrics {
+	fileServiceMetrics := &FileServiceMetrics{}
+
+	fileServiceMetrics.ConfigPushCount =
 		prometheus.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: MetricNameTranslationCount,
-				Help: "Count of translations from Kubernetes state to Kong state. `" +
-					SuccessKey + "` describes whether there were unrecoverable errors (`" +
-					SuccessFalse + "`) or not (`" + SuccessTrue + "`).",
+				Name: MetricNameConfigPushCount,
+				Help: "Count of successful/failed Admin API calls handling files in Kong, each retry counted as a call. `" +
+					KindKey + "` describes the kind of the files, empty when they are not KongFiles, `" +
+					WorkspaceKey + "` the Kong workspace and `" +
+					OperationKey + "` the operation (" + OperationCreate + ", " + OperationGet + ", " + OperationUpdate + ", " +
+					OperationDelete + " or " + OperationList + "). `" +
+					SuccessKey + "` describes whether the call failed (`" +
+					SuccessFalse + "`) or not (`" + SuccessTrue + "`), a file found not to exist being no failure.",
 			},
-			[]string{SuccessKey},
+			[]string{SuccessKey, KindKey, WorkspaceKey, OperationKey},
 		)
 
-	controllerMetrics.ConfigPushDuration =
+	fileServiceMetrics.ConfigPushDuration =
 		prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name: MetricNameConfigPushDuration,
-				Help: "How long it took to push the developer to Kong, in milliseconds. `" +
-					ProtocolKey + "` describes the developer protocol (" + ProtocolDBLess + " or " +
-					ProtocolDeck + ") in use. `" +
-					SuccessKey + "` describes whether there were unrecoverable errors (`" +
-					SuccessFalse + "`) or not (`" + SuccessTrue + "`).",
+				Help: "How long Admin API calls handling files in Kong took, in milliseconds, each retry observed as a call. `" +
+					KindKey + "` describes the kind of the files, empty when they are not KongFiles, `" +
+					WorkspaceKey + "` the Kong workspace and `" +
+					OperationKey + "` the operation (" + OperationCreate + ", " + OperationGet + ", " + OperationUpdate + ", " +
+					OperationDelete + " or " + OperationList + "). `" +
+					SuccessKey + "` describes whether the call failed (`" +
+					SuccessFalse + "`) or not (`" + SuccessTrue + "`), a file found not to exist being no failure.",
 				Buckets: prometheus.ExponentialBuckets(100, 1.33, 30),
 			},
-			[]string{SuccessKey, ProtocolKey},
+			[]string{SuccessKey, KindKey, WorkspaceKey, OperationKey},
 		)
 
-	metrics.Registry.MustRegister(controllerMetrics.ConfigPushCount, controllerMetrics.TranslationCount, controllerMetrics.ConfigPushDuration)
+	metrics.Registry.MustRegister(fileServiceMetrics.ConfigPushCount, fileServiceMetrics.ConfigPushDuration)
 
-	return controllerMetrics
+	return fileServiceMetrics
+}
+
+type GCMetrics struct {
+	// FilesCollectedCount is a Prometheus metric with semantics defined by its help string in NewGCMetrics().
+	FilesCollectedCount *prometheus.CounterVec
+}
+
+func NewGCMetrics() *GCMetrics {
+	gcMetrics := &GCMetrics{}
+
+	gcMetrics.FilesCollectedCount =
+		prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: MetricNameFilesCollectedCount,
+				Help: "Count of orphaned Kong files removed by the garbage collector. `" +
+					DryRunKey + "` describes whether the files were only reported (`" +
+					SuccessTrue + "`) or actually deleted (`" + SuccessFalse + "`).",
+			},
+			[]string{DryRunKey},
+		)
+
+	metrics.Registry.MustRegister(gcMetrics.FilesCollectedCount)
+
+	return gcMetrics
+}
+
+type CertificateMetrics struct {
+	// CertificateExpiry is a Prometheus metric with semantics defined by its help string in NewCertificateMetrics().
+	CertificateExpiry *prometheus.GaugeVec
+
+	// CertificateReloadCount is a Prometheus metric with semantics defined by its help string in NewCertificateMetrics().
+	CertificateReloadCount *prometheus.CounterVec
+}
+
+func NewCertificateMetrics() *CertificateMetrics {
+	certificateMetrics := &CertificateMetrics{}
+
+	certificateMetrics.CertificateExpiry =
+		prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: MetricNameCertificateExpiry,
+				Help: "Expiry time of the TLS certificates in use, in seconds since epoch. `" +
+					CertificateKey + "` describes the certificate, a CA bundle being described by its earliest expiry.",
+			},
+			[]string{CertificateKey},
+		)
+
+	certificateMetrics.CertificateReloadCount =
+		prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: MetricNameCertificateReloadCount,
+				Help: "Count of reloads of TLS certificates whose files changed on disk. `" +
+					CertificateKey + "` describes the certificate. `" +
+					SuccessKey + "` describes whether the new files could not be loaded (`" +
+					SuccessFalse + "`) or could (`" + SuccessTrue + "`).",
+			},
+			[]string{CertificateKey, SuccessKey},
+		)
+
+	metrics.Registry.MustRegister(certificateMetrics.CertificateExpiry, certificateMetrics.CertificateReloadCount)
+
+	return certificateMetrics
 }
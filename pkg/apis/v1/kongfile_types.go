@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,6 +29,14 @@ const (
 	ASSET              = "ASSET"
 )
 
+// ContentEncoding is the encoding of the KongFile content, decoded before it is published
+type ContentEncoding string
+
+const (
+	// ContentEncodingGzipBase64 is a gzip compressed content, encoded in base64
+	ContentEncodingGzipBase64 ContentEncoding = "gzip+base64"
+)
+
 // KongFileSpec defines the desired state of KongFile
 type KongFileSpec struct {
 
@@ -46,17 +55,124 @@ type KongFileSpec struct {
 	// KongFile name
 	Content string `json:"content,omitempty" yaml:"content,omitempty"`
 
+	// BinaryContent is the binary content of ASSET KongFiles, such as images or fonts, instead of content
+	BinaryContent []byte `json:"binaryContent,omitempty" yaml:"binaryContent,omitempty"`
+
+	// ContentFrom is the source of the KongFile content, instead of content
+	ContentFrom *KongFileContentSource `json:"contentFrom,omitempty" yaml:"contentFrom,omitempty"`
+
+	// ContentEncoding is the encoding of content, or of the content read from contentFrom, when it is not published as is
+	ContentEncoding ContentEncoding `json:"contentEncoding,omitempty" yaml:"contentEncoding,omitempty"`
+
 	// KongFile kind
 	Kind Kind `json:"kind,omitempty" yaml:"kind,omitempty"`
 }
 
+// KongFileContentSource selects the source of the KongFile content, only one of its fields may be set
+type KongFileContentSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap of the KongFile namespace, the keys of its binaryData
+	// providing binary content
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty" yaml:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret of the KongFile namespace, the Secret must be annotated with
+	// developer.konghq.com/content-source: "true" to be published
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty" yaml:"secretKeyRef,omitempty"`
+
+	// File is the path of a file relative to the content root of the controller, such as a mounted volume
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// KongFileFinalizer is the finalizer removing the file from Kong before a KongFile is released
+const KongFileFinalizer = "developer.konghq.com/kong-file-cleanup"
+
+// KongFile condition types
+const (
+	// KongFileConditionAccepted indicates whether the KongFile spec has been accepted by the controller
+	KongFileConditionAccepted = "Accepted"
+
+	// KongFileConditionPublished indicates whether the KongFile is published in Kong
+	KongFileConditionPublished = "Published"
+
+	// KongFileConditionDrifted indicates whether the file in Kong differs from the KongFile
+	KongFileConditionDrifted = "Drifted"
+
+	// KongFileConditionDegraded indicates whether the last operation against the Kong Admin API failed
+	KongFileConditionDegraded = "Degraded"
+
+	// KongFileConditionConflict indicates whether an older KongFile already publishes a file at the same path in Kong
+	KongFileConditionConflict = "Conflict"
+
+	// KongFileConditionResolvedRefs indicates whether the content of the KongFile could be read from spec.contentFrom
+	KongFileConditionResolvedRefs = "ResolvedRefs"
+)
+
+// KongFile condition reasons
+const (
+	KongFileReasonAccepted = "Accepted"
+	KongFileReasonInvalid  = "Invalid"
+
+	KongFileReasonPending       = "Pending"
+	KongFileReasonPublished     = "Published"
+	KongFileReasonPublishFailed = "PublishFailed"
+	KongFileReasonRejected      = "Rejected"
+	KongFileReasonConflict      = "Conflict"
+	KongFileReasonDeleteFailed  = "DeleteFailed"
+	KongFileReasonUnpublished   = "Unpublished"
+
+	KongFileReasonInSync  = "InSync"
+	KongFileReasonDrifted = "Drifted"
+
+	KongFileReasonPathConflict = "PathConflict"
+	KongFileReasonNoConflict   = "NoConflict"
+
+	KongFileReasonResolvedRefs = "ResolvedRefs"
+	KongFileReasonRefNotFound  = "RefNotFound"
+	KongFileReasonInvalidRef   = "InvalidRef"
+
+	KongFileReasonAsExpected          = "AsExpected"
+	KongFileReasonAdminAPIRejected    = "AdminAPIRejected"
+	KongFileReasonAdminAPIError       = "AdminAPIError"
+	KongFileReasonAdminAPIUnreachable = "AdminAPIUnreachable"
+)
+
 // KongFileStatus defines the observed state of KongFile
 type KongFileStatus struct {
-	Validated bool `json:"validated,omitempty" yaml:"validated,omitempty"`
+	// KongFile conditions
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+
+	// ObservedGeneration is the metadata.generation of the KongFile last published to Kong
+	ObservedGeneration int64 `json:"observedGeneration,omitempty" yaml:"observedGeneration,omitempty"`
+
+	// ID of the file in Kong
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+
+	// Checksum of the file in Kong
+	Checksum string `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+
+	// CreatedAt is the creation time of the file in Kong, in seconds since epoch
+	CreatedAt int64 `json:"createdAt,omitempty" yaml:"createdAt,omitempty"`
+
+	// Path of the file in Kong
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// Workspace of the file in Kong
+	Workspace string `json:"workspace,omitempty" yaml:"workspace,omitempty"`
+
+	// LastSyncedTime is the last time the file was written to Kong
+	LastSyncedTime *metav1.Time `json:"lastSyncedTime,omitempty" yaml:"lastSyncedTime,omitempty"`
+
+	// ContentChecksum is the checksum of the content read from spec.contentFrom when it was last submitted to Kong
+	ContentChecksum string `json:"contentChecksum,omitempty" yaml:"contentChecksum,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.kind`
+//+kubebuilder:printcolumn:name="Path",type=string,JSONPath=`.status.path`
+//+kubebuilder:printcolumn:name="Published",type=string,JSONPath=`.status.conditions[?(@.type=="Published")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // KongFile is the Schema for the kongFiles API
 type KongFile struct {